@@ -2,6 +2,10 @@ package azfunc
 
 import (
 	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/vladbarosan/func-go/internal/hosttime"
 )
 
 // Context contains the runtime context of the function
@@ -31,20 +35,92 @@ type Timer struct {
 
 // ScheduleStatus contains the schedule for a Timer.
 type ScheduleStatus struct {
-	Next        string `json:"Next"`
-	Last        string `json:"Last"`
-	LastUpdated string `json:"LastUpdated"`
+	Next        time.Time `json:"Next"`
+	Last        time.Time `json:"Last"`
+	LastUpdated time.Time `json:"LastUpdated"`
+
+	// the dates as sent by the host
+	next, last, lastUpdated string
+}
+
+// UnmarshalJSON decodes the schedule sent by the host, keeping its dates as they were sent.
+// A date that cannot be parsed is logged and left zero.
+func (s *ScheduleStatus) UnmarshalJSON(b []byte) error {
+	var raw struct {
+		Next        string `json:"Next"`
+		Last        string `json:"Last"`
+		LastUpdated string `json:"LastUpdated"`
+	}
+	if err := json.Unmarshal(b, &raw); err != nil {
+		return err
+	}
+
+	s.next, s.last, s.lastUpdated = raw.Next, raw.Last, raw.LastUpdated
+	s.Next = hosttime.Field("Next", raw.Next)
+	s.Last = hosttime.Field("Last", raw.Last)
+	s.LastUpdated = hosttime.Field("LastUpdated", raw.LastUpdated)
+	return nil
+}
+
+// NextString returns Next as sent by the host
+func (s ScheduleStatus) NextString() string {
+	return rawTime(s.next, s.Next, offsetLayout)
+}
+
+// LastString returns Last as sent by the host
+func (s ScheduleStatus) LastString() string {
+	return rawTime(s.last, s.Last, offsetLayout)
+}
+
+// LastUpdatedString returns LastUpdated as sent by the host
+func (s ScheduleStatus) LastUpdatedString() string {
+	return rawTime(s.lastUpdated, s.LastUpdated, offsetLayout)
 }
 
 // QueueMsg represents an Azure queue message.
 type QueueMsg struct {
-	Text         string `json:"azfuncdata"`
-	ID           string `json:"Id"`
-	Insertion    string `json:"InsertionTime"`
-	Expiration   string `json:"ExpirationTime"`
-	PopReceipt   string `json:"PopReceipt"`
-	NextVisible  string `json:"NextVisibleTime"`
-	DequeueCount int    `json:"DequeueCount"`
+	Text         string    `json:"azfuncdata"`
+	ID           string    `json:"Id"`
+	Insertion    time.Time `json:"InsertionTime"`
+	Expiration   time.Time `json:"ExpirationTime"`
+	PopReceipt   string    `json:"PopReceipt"`
+	NextVisible  time.Time `json:"NextVisibleTime"`
+	DequeueCount int       `json:"DequeueCount"`
+
+	// the dates as sent by the host
+	insertion, expiration, nextVisible string
+}
+
+// keepTime keeps the dates of the message as sent by the host
+func (m *QueueMsg) keepTime(name, text string) {
+	switch name {
+	case "InsertionTime":
+		m.insertion = text
+	case "ExpirationTime":
+		m.expiration = text
+	case "NextVisibleTime":
+		m.nextVisible = text
+	}
+}
+
+// InsertionString returns Insertion as sent by the host
+func (m QueueMsg) InsertionString() string {
+	return rawTime(m.insertion, m.Insertion, offsetLayout)
+}
+
+// ExpirationString returns Expiration as sent by the host
+func (m QueueMsg) ExpirationString() string {
+	return rawTime(m.expiration, m.Expiration, offsetLayout)
+}
+
+// NextVisibleString returns NextVisible as sent by the host
+func (m QueueMsg) NextVisibleString() string {
+	return rawTime(m.nextVisible, m.NextVisible, offsetLayout)
+}
+
+// TimeToLive returns how long the message stays in the queue after its insertion
+func (m QueueMsg) TimeToLive() time.Duration {
+	return m.Expiration.Sub(m.Insertion)
 }
 
 // Blob contains the data from a blob as string.
@@ -77,11 +153,36 @@ type EventGridEvent struct {
 	// EventType - The type of the event that occurred.
 	EventType string `json:"eventType"`
 	// EventTime - The time (in UTC) the event was generated.
-	EventTime string `json:"eventTime"`
+	EventTime time.Time `json:"eventTime"`
 	// MetadataVersion - The schema version of the event metadata.
 	MetadataVersion string `json:"metadataVersion"`
 	// DataVersion - The schema version of the data object.
 	DataVersion string `json:"dataVersion"`
+
+	// the event time as sent by the host
+	eventTime string
+}
+
+// UnmarshalJSON decodes the event sent by the host, keeping its time as it was sent.
+// A time that cannot be parsed is logged and left zero.
+func (e *EventGridEvent) UnmarshalJSON(b []byte) error {
+	type event EventGridEvent
+	raw := struct {
+		*event
+		EventTime string `json:"eventTime"`
+	}{event: (*event)(e)}
+	if err := json.Unmarshal(b, &raw); err != nil {
+		return err
+	}
+
+	e.eventTime = raw.EventTime
+	e.EventTime = hosttime.Field("EventTime", raw.EventTime)
+	return nil
+}
+
+// EventTimeString returns EventTime as sent by the host
+func (e EventGridEvent) EventTimeString() string {
+	return rawTime(e.eventTime, e.EventTime, utcLayout)
 }
 
 // EventHubEvent represents properties of an event sent to an Event Hub.
@@ -90,8 +191,23 @@ type EventHubEvent struct {
 	PartitionKey    *string                `json:"PartitionKey"`
 	SequenceNumber  int                    `json:"SequenceNumber"`
 	Offset          int                    `json:"Offset"`
-	EnqueuedTimeUtc string                 `json:"EnqueuedTimeUtc"`
+	EnqueuedTimeUtc time.Time              `json:"EnqueuedTimeUtc"`
 	Properties      map[string]interface{} `json:"Properties"`
+
+	// the enqueued time as sent by the host
+	enqueuedTimeUtc string
+}
+
+// keepTime keeps the enqueued time of the event as sent by the host
+func (e *EventHubEvent) keepTime(name, text string) {
+	if name == "EnqueuedTimeUtc" {
+		e.enqueuedTimeUtc = text
+	}
+}
+
+// EnqueuedTimeUtcString returns EnqueuedTimeUtc as sent by the host
+func (e EventHubEvent) EnqueuedTimeUtcString() string {
+	return rawTime(e.enqueuedTimeUtc, e.EnqueuedTimeUtc, utcLayout)
 }
 
 // SBMsg represents a Service Bus Brokered Message.
@@ -100,8 +216,8 @@ type SBMsg struct {
 	MessageID        string                 `json:"MessageId"`
 	DeliveryCount    uint32                 `json:"DeliveryCount"`
 	SequenceNumber   int64                  `json:"SequenceNumber"`
-	ExpiresAtUtc     string                 `json:"ExpiresAtUtc"`
-	EnqueuedTimeUtc  string                 `json:"EnqueuedTimeUtc"`
+	ExpiresAtUtc     time.Time              `json:"ExpiresAtUtc"`
+	EnqueuedTimeUtc  time.Time              `json:"EnqueuedTimeUtc"`
 	ReplyTo          *string                `json:"ReplyTo"`
 	To               *string                `json:"To"`
 	CorrelationID    *string                `json:"CorrelationId"`
@@ -109,4 +225,55 @@ type SBMsg struct {
 	ContentType      *string                `json:"ContentType"`
 	DeadLetterSource *string                `json:"DeadLetterSource"`
 	UserProperties   map[string]interface{} `json:"UserProperties"`
+
+	// the dates as sent by the host
+	expiresAtUtc, enqueuedTimeUtc string
+}
+
+// keepTime keeps the dates of the message as sent by the host
+func (m *SBMsg) keepTime(name, text string) {
+	switch name {
+	case "ExpiresAtUtc":
+		m.expiresAtUtc = text
+	case "EnqueuedTimeUtc":
+		m.enqueuedTimeUtc = text
+	}
+}
+
+// ExpiresAtUtcString returns ExpiresAtUtc as sent by the host
+func (m SBMsg) ExpiresAtUtcString() string {
+	return rawTime(m.expiresAtUtc, m.ExpiresAtUtc, utcLayout)
+}
+
+// EnqueuedTimeUtcString returns EnqueuedTimeUtc as sent by the host
+func (m SBMsg) EnqueuedTimeUtcString() string {
+	return rawTime(m.enqueuedTimeUtc, m.EnqueuedTimeUtc, utcLayout)
+}
+
+// timeKeeper is implemented by the binding types keeping the dates of the trigger metadata as the host sent them
+type timeKeeper interface {
+	keepTime(name, text string)
+}
+
+func init() {
+	hosttime.Keep = func(v interface{}, name, raw string) {
+		if k, ok := v.(timeKeeper); ok {
+			k.keepTime(name, raw)
+		}
+	}
+}
+
+// Layouts of the ISO 8601 dates sent by the host, with up to 7 fractional digits
+const (
+	offsetLayout = "2006-01-02T15:04:05.9999999-07:00"
+	utcLayout    = "2006-01-02T15:04:05.9999999Z07:00"
+)
+
+// rawTime returns raw, the date as sent by the host, or t formatted with layout
+// if the value was not decoded from the host, or "" if t is not set either
+func rawTime(raw string, t time.Time, layout string) string {
+	if raw != "" || t.IsZero() {
+		return raw
+	}
+	return t.Format(layout)
 }
@@ -0,0 +1,98 @@
+package azfunc
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+)
+
+// DataKind is the encoding of binding data exchanged with the host
+type DataKind int
+
+// DataKind values
+const (
+	DataString DataKind = iota
+	DataJSON
+	DataBytes
+	DataStream
+	DataInt
+	DataDouble
+	DataHTTP
+)
+
+func (k DataKind) String() string {
+	switch k {
+	case DataString:
+		return "string"
+	case DataJSON:
+		return "json"
+	case DataBytes:
+		return "bytes"
+	case DataStream:
+		return "stream"
+	case DataInt:
+		return "int"
+	case DataDouble:
+		return "double"
+	case DataHTTP:
+		return "http"
+	default:
+		return fmt.Sprintf("DataKind(%d)", int(k))
+	}
+}
+
+// RawData is the undecoded data of a binding or of a trigger metadata field.
+// Value holds the text of strings and JSON, the content of bytes and streams,
+// the decimal representation of numbers and the body of HTTP requests.
+type RawData struct {
+	Kind  DataKind
+	Value []byte
+}
+
+// BindingUnmarshaler is implemented by types that decode themselves from binding data.
+// metadata contains the trigger metadata of the invocation.
+type BindingUnmarshaler interface {
+	UnmarshalBinding(data RawData, metadata map[string]RawData) error
+}
+
+// BindingMarshaler is implemented by types that encode themselves into output binding data
+type BindingMarshaler interface {
+	MarshalBinding() (RawData, error)
+}
+
+// Converter decodes and encodes binding data for a type that cannot implement
+// BindingUnmarshaler or BindingMarshaler itself, like types from other packages.
+// Either function can be nil if the type is only used as input or only as output.
+type Converter struct {
+	// Unmarshal returns a value of the registered type from binding data
+	Unmarshal func(data RawData, metadata map[string]RawData) (interface{}, error)
+	// Marshal returns the binding data of a value of the registered type
+	Marshal func(v interface{}) (RawData, error)
+}
+
+var converters = struct {
+	sync.RWMutex
+	m map[reflect.Type]Converter
+}{m: map[reflect.Type]Converter{}}
+
+// RegisterConverter registers c for the type of sample, replacing any converter registered before.
+// Registered converters take precedence over BindingUnmarshaler, BindingMarshaler and the built-in conversions.
+// It is meant to be called from the init function of a function package.
+func RegisterConverter(sample interface{}, c Converter) {
+	t := reflect.TypeOf(sample)
+	if t == nil {
+		panic("azfunc: RegisterConverter of nil type")
+	}
+
+	converters.Lock()
+	defer converters.Unlock()
+	converters.m[t] = c
+}
+
+// ConverterFor returns the converter registered for t
+func ConverterFor(t reflect.Type) (Converter, bool) {
+	converters.RLock()
+	defer converters.RUnlock()
+	c, ok := converters.m[t]
+	return c, ok
+}
@@ -0,0 +1,57 @@
+package azfunc
+
+import (
+	"fmt"
+	"runtime/debug"
+)
+
+// Error is an error returned by a function with details on how the host should report it.
+// Functions with an http output binding respond with StatusCode and Body instead of failing,
+// other functions fail with an exception carrying the stack trace and whether a retry can succeed.
+type Error struct {
+	// Err is the cause of the failure
+	Err error
+	// StatusCode is the HTTP status of the response, http.StatusInternalServerError if it is 0
+	StatusCode int
+	// Body is the HTTP response body. Strings and byte slices are sent as they are,
+	// other values as JSON. The message of Err is sent if it is nil.
+	Body interface{}
+	// Retryable tells whether the invocation can succeed if the trigger is retried
+	Retryable bool
+	// StackTrace is reported with the exception of the invocation
+	StackTrace string
+}
+
+// NewError returns an Error with the given HTTP status code, capturing the stack trace of the caller
+func NewError(statusCode int, err error) *Error {
+	return &Error{
+		Err:        err,
+		StatusCode: statusCode,
+		StackTrace: string(debug.Stack()),
+	}
+}
+
+// Errorf returns an Error with the given HTTP status code and a formatted message, capturing the stack trace of the caller
+func Errorf(statusCode int, format string, args ...interface{}) *Error {
+	return &Error{
+		Err:        fmt.Errorf(format, args...),
+		StatusCode: statusCode,
+		StackTrace: string(debug.Stack()),
+	}
+}
+
+// RetryableError returns a retryable Error for a transient failure, capturing the stack trace of the caller
+func RetryableError(err error) *Error {
+	return &Error{
+		Err:        err,
+		Retryable:  true,
+		StackTrace: string(debug.Stack()),
+	}
+}
+
+func (e *Error) Error() string {
+	if e.Err == nil {
+		return fmt.Sprintf("function failed with status %d", e.StatusCode)
+	}
+	return e.Err.Error()
+}
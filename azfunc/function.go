@@ -0,0 +1,21 @@
+package azfunc
+
+// Function describes an entry point with the names of the bindings of its parameters and results.
+// A plugin exporting a Function variable under the name of the entry point, e.g.
+//
+//	var Run = azfunc.Function{
+//		Handler: handler.Serve,
+//		In:      []string{"", "req", "inBlob"},
+//		Out:     []string{"outBlob", ""},
+//	}
+//
+// is bound without parsing its source, so Handler can also be a method value or a closure.
+type Function struct {
+	// Handler is the func called for every invocation
+	Handler interface{}
+	// In has the binding name of every parameter of Handler in order, "" for the Context
+	In []string
+	// Out has the binding name of every result of Handler in order,
+	// "" for the error and for a single result bound to $return
+	Out []string
+}
@@ -0,0 +1,25 @@
+package azfunc
+
+import (
+	"context"
+	"net/http"
+)
+
+type routeParamsKey struct{}
+
+// WithRouteParams returns a copy of ctx carrying the route parameters of an HTTP trigger
+func WithRouteParams(ctx context.Context, params map[string]string) context.Context {
+	return context.WithValue(ctx, routeParamsKey{}, params)
+}
+
+// RouteParams returns the route parameters of an HTTP trigger request,
+// e.g. {"id": "42"} for the route "products/{id}" and the URL /api/products/42
+func RouteParams(r *http.Request) map[string]string {
+	params, _ := r.Context().Value(routeParamsKey{}).(map[string]string)
+	return params
+}
+
+// RouteParam returns the value of the named route parameter of an HTTP trigger request, or "" if there is none
+func RouteParam(r *http.Request, name string) string {
+	return RouteParams(r)[name]
+}
@@ -0,0 +1,23 @@
+package azfunc
+
+// Invocation is a function invocation as seen by middleware
+type Invocation struct {
+	// Context is passed to the function, middleware can replace it with one derived from it
+	Context Context
+	// Inputs has the decoded data of every input binding by name,
+	// changing them changes what the function receives
+	Inputs map[string]interface{}
+	// Outputs has the data of every output binding by name once the function returned,
+	// with the return value under "$return". Changing them changes what is sent to the host.
+	Outputs map[string]interface{}
+}
+
+// Handler runs an invocation and returns the error of the function
+type Handler func(inv *Invocation) error
+
+// Middleware wraps the Handler of invocations with code running before and after them,
+// like authorization checks, logging, metrics or recovering from panics.
+// A panic in the function goes up through the middleware, which can recover it and set the outputs and the error.
+// The worker applies its own middleware around the middleware exported by a plugin
+// in a variable named Middleware of type []azfunc.Middleware, which applies to the functions of the plugin.
+type Middleware func(next Handler) Handler
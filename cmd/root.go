@@ -5,6 +5,9 @@ import (
 	"fmt"
 	"math"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	log "github.com/Sirupsen/logrus"
 	"github.com/spf13/cobra"
@@ -18,6 +21,11 @@ var (
 	workerID             string
 	requestID            string
 	grpcMaxMessageLength int
+	shutdownGracePeriod  time.Duration
+	heartbeatInterval    time.Duration
+	maxReconnectAttempts int
+	reconnectBackoff     time.Duration
+	maxReconnectBackoff  time.Duration
 )
 
 var rootCmd = &cobra.Command{
@@ -45,6 +53,11 @@ func init() {
 	rootCmd.Flags().StringVar(&workerID, "workerId", "", "RPC Server Worker ID")
 	rootCmd.Flags().StringVar(&requestID, "requestId", "", "Request ID")
 	rootCmd.Flags().IntVar(&grpcMaxMessageLength, "grpcMaxMessageLength", math.MaxInt32, "Max message length")
+	rootCmd.Flags().DurationVar(&shutdownGracePeriod, "shutdownGracePeriod", 10*time.Second, "Time in-flight invocations are given to finish on SIGTERM")
+	rootCmd.Flags().DurationVar(&heartbeatInterval, "heartbeatInterval", 0, "Interval between heartbeats sent to the host, 0 to disable")
+	rootCmd.Flags().IntVar(&maxReconnectAttempts, "maxReconnectAttempts", 10, "Reconnect attempts when the event stream drops, -1 for unlimited")
+	rootCmd.Flags().DurationVar(&reconnectBackoff, "reconnectBackoff", 500*time.Millisecond, "Initial delay between reconnect attempts")
+	rootCmd.Flags().DurationVar(&maxReconnectBackoff, "maxReconnectBackoff", 30*time.Second, "Maximum delay between reconnect attempts")
 
 	if flagDebug {
 		log.SetLevel(log.DebugLevel)
@@ -53,11 +66,16 @@ func init() {
 
 func startWorker(args []string) {
 	cfg := &worker.ClientConfig{
-		Host:             host,
-		Port:             port,
-		WorkerID:         workerID,
-		RequestID:        requestID,
-		MaxMessageLength: grpcMaxMessageLength,
+		Host:                 host,
+		Port:                 port,
+		WorkerID:             workerID,
+		RequestID:            requestID,
+		MaxMessageLength:     grpcMaxMessageLength,
+		ShutdownGracePeriod:  shutdownGracePeriod,
+		HeartbeatInterval:    heartbeatInterval,
+		MaxReconnectAttempts: maxReconnectAttempts,
+		ReconnectBackoff:     reconnectBackoff,
+		MaxReconnectBackoff:  maxReconnectBackoff,
 	}
 	client := worker.NewClient(cfg)
 	err := client.Connect()
@@ -67,6 +85,14 @@ func startWorker(args []string) {
 	}
 	defer client.Disconnect()
 
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGTERM, os.Interrupt)
+	go func() {
+		s := <-signals
+		log.Debugf("received signal %v", s)
+		client.Shutdown(cfg.ShutdownGracePeriod)
+	}()
+
 	err = client.StartEventStream(context.Background())
 
 	if err != nil {
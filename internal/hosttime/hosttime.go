@@ -0,0 +1,74 @@
+// Package hosttime parses the dates sent by the Azure Functions host.
+// It is shared by the worker and package azfunc so that every date is parsed the same way.
+package hosttime
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// layouts are the layouts of the dates sent by the host, tried in order
+var layouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02T15:04:05.999999999",
+	"2006-01-02 15:04:05.999999999Z07:00",
+	"2006-01-02 15:04:05.999999999",
+	"1/2/2006 3:04:05 PM -07:00",
+	"1/2/2006 3:04:05 PM",
+	time.RFC1123,
+	time.RFC1123Z,
+	"2006-01-02",
+}
+
+// dotNetJSONDate matches the /Date(milliseconds[+-offset])/ format of .NET JSON serializers
+var dotNetJSONDate = regexp.MustCompile(`^/Date\((-?\d+)([+-]\d{4})?\)/$`)
+
+// Keep is set by package azfunc to keep the date raw, as the host sent it in the trigger metadata
+// field name, in v, a pointer to one of its binding types. Other values are left as they are.
+var Keep = func(v interface{}, name, raw string) {}
+
+// Parse parses the date formats used by the host
+func Parse(s string) (time.Time, error) {
+	s = strings.TrimSpace(s)
+
+	if m := dotNetJSONDate.FindStringSubmatch(s); m != nil {
+		ms, err := strconv.ParseInt(m[1], 10, 64)
+		if err != nil {
+			return time.Time{}, err
+		}
+		tm := time.Unix(0, ms*int64(time.Millisecond)).UTC()
+		if m[2] == "" {
+			return tm, nil
+		}
+		offset, err := time.Parse("-0700", m[2])
+		if err != nil {
+			return time.Time{}, err
+		}
+		return tm.In(offset.Location()), nil
+	}
+
+	for _, layout := range layouts {
+		if tm, err := time.Parse(layout, s); err == nil {
+			return tm, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("cannot parse %q as a date", s)
+}
+
+// Field returns the date s of the field name of a binding type, the zero time if s is empty.
+// A date that cannot be parsed is logged and left zero, the invocation goes on.
+func Field(name, s string) time.Time {
+	if s == "" {
+		return time.Time{}
+	}
+	tm, err := Parse(s)
+	if err != nil {
+		log.Warnf("field %s is left zero: %v", name, err)
+	}
+	return tm
+}
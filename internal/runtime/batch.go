@@ -0,0 +1,72 @@
+package runtime
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/vladbarosan/func-go/internal/rpc"
+)
+
+// batchMetadataSuffix ends the names of the trigger metadata holding one value per item of a batch,
+// like PartitionKeyArray for Event Hubs or MessageIdArray for Service Bus
+const batchMetadataSuffix = "Array"
+
+// decodeBatch decodes the items of a batch trigger into a slice of structs.
+// Each item gets the element at its index of every <Field>Array trigger metadata as the <Field> metadata.
+// It returns false if pt is not a slice of structs or data is not a JSON array.
+func decodeBatch(pt reflect.Type, data *rpc.TypedData, tm map[string]*rpc.TypedData) (reflect.Value, bool, error) {
+	if pt.Kind() != reflect.Slice || pt == bytesType {
+		return reflect.Value{}, false, nil
+	}
+	et := pt.Elem()
+	if et.Kind() == reflect.Ptr {
+		et = et.Elem()
+	}
+	if et.Kind() != reflect.Struct || et == timeType {
+		return reflect.Value{}, false, nil
+	}
+
+	var items []json.RawMessage
+	if _, ok := data.GetData().(*rpc.TypedData_Json); !ok || json.Unmarshal([]byte(data.GetJson()), &items) != nil {
+		return reflect.Value{}, false, nil
+	}
+
+	shared, arrays := splitBatchMetadata(tm)
+	v := reflect.MakeSlice(pt, len(items), len(items))
+	for i, item := range items {
+		meta := make(map[string]*rpc.TypedData, len(shared)+len(arrays))
+		for k, d := range shared {
+			meta[k] = d
+		}
+		for k, values := range arrays {
+			if i < len(values) {
+				meta[k] = &rpc.TypedData{Data: &rpc.TypedData_Json{Json: string(values[i])}}
+			}
+		}
+
+		ev, err := convertToTypeValue(pt.Elem(), &rpc.TypedData{Data: &rpc.TypedData_Json{Json: string(item)}}, meta)
+		if err != nil {
+			return reflect.Value{}, true, fmt.Errorf("cannot decode item %d of batch: %v", i, err)
+		}
+		v.Index(i).Set(ev)
+	}
+	return v, true, nil
+}
+
+// splitBatchMetadata separates the trigger metadata shared by all the items of a batch
+// from the per item arrays, which are returned under the name of their field
+func splitBatchMetadata(tm map[string]*rpc.TypedData) (map[string]*rpc.TypedData, map[string][]json.RawMessage) {
+	shared := map[string]*rpc.TypedData{}
+	arrays := map[string][]json.RawMessage{}
+	for k, d := range tm {
+		var values []json.RawMessage
+		if strings.HasSuffix(k, batchMetadataSuffix) && d.GetJson() != "" && json.Unmarshal([]byte(d.GetJson()), &values) == nil {
+			arrays[strings.TrimSuffix(k, batchMetadataSuffix)] = values
+			continue
+		}
+		shared[k] = d
+	}
+	return shared, arrays
+}
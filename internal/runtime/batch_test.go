@@ -0,0 +1,107 @@
+package runtime
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/vladbarosan/func-go/azfunc"
+	"github.com/vladbarosan/func-go/internal/rpc"
+)
+
+func jsonData(s string) *rpc.TypedData {
+	return &rpc.TypedData{Data: &rpc.TypedData_Json{Json: s}}
+}
+
+func TestConvertToTypeValue_EventHubBatch(t *testing.T) {
+	data := jsonData(`["first event", {"temperature": 21.5}]`)
+	tm := map[string]*rpc.TypedData{
+		"PartitionContext":     jsonData(`{"ConsumerGroupName":"$Default","EventHubPath":"demo-go-func-batch-in"}`),
+		"PartitionKeyArray":    jsonData(`["device-1", null]`),
+		"OffsetArray":          jsonData(`["4294967296", "4294967464"]`),
+		"SequenceNumberArray":  jsonData(`[41, 42]`),
+		"EnqueuedTimeUtcArray": jsonData(`["2018-07-18T08:15:08.288Z", "2018-07-18T08:15:09.5Z"]`),
+		"PropertiesArray":      jsonData(`[{"source": "sensor"}, {}]`),
+	}
+	key := "device-1"
+
+	want := []azfunc.EventHubEvent{
+		{
+			Data:            "first event",
+			PartitionKey:    &key,
+			Offset:          4294967296,
+			SequenceNumber:  41,
+			EnqueuedTimeUtc: time.Date(2018, 7, 18, 8, 15, 8, 288000000, time.UTC),
+			Properties:      map[string]interface{}{"source": "sensor"},
+		},
+		{
+			Data:            `{"temperature": 21.5}`,
+			Offset:          4294967464,
+			SequenceNumber:  42,
+			EnqueuedTimeUtc: time.Date(2018, 7, 18, 8, 15, 9, 500000000, time.UTC),
+			Properties:      map[string]interface{}{},
+		},
+	}
+
+	for _, typ := range []reflect.Type{reflect.TypeOf([]azfunc.EventHubEvent{}), reflect.TypeOf([]*azfunc.EventHubEvent{})} {
+		t.Run(typ.String(), func(t *testing.T) {
+			r, err := convertToTypeValue(typ, data, tm)
+			if err != nil {
+				t.Fatalf("failed to get a value, got error: %v", err)
+			}
+			if got := r.Type(); got != typ {
+				t.Fatalf("got:  %v\nwant: %v", got, typ)
+			}
+			if got, want := r.Len(), len(want); got != want {
+				t.Fatalf("got:  %d\nwant: %d", got, want)
+			}
+
+			for i := range want {
+				got := reflect.Indirect(r.Index(i)).Interface().(azfunc.EventHubEvent)
+				if !got.EnqueuedTimeUtc.Equal(want[i].EnqueuedTimeUtc) {
+					t.Logf("got:  %v\nwant: %v", got.EnqueuedTimeUtc, want[i].EnqueuedTimeUtc)
+					t.Fail()
+				}
+				got.EnqueuedTimeUtc = want[i].EnqueuedTimeUtc
+				if !reflect.DeepEqual(exportedFields(got), exportedFields(want[i])) {
+					t.Logf("got:  %+v\nwant: %+v", got, want[i])
+					t.Fail()
+				}
+			}
+		})
+	}
+}
+
+func TestConvertToTypeValue_ServiceBusBatch(t *testing.T) {
+	data := jsonData(`["Message 1", "Message 2"]`)
+	tm := map[string]*rpc.TypedData{
+		"MessageIdArray":      jsonData(`["id-1", "id-2"]`),
+		"DeliveryCountArray":  jsonData(`[1, 3]`),
+		"UserPropertiesArray": jsonData(`[{"a": "b"}, {}]`),
+	}
+
+	r, err := convertToTypeValue(reflect.TypeOf([]azfunc.SBMsg{}), data, tm)
+	if err != nil {
+		t.Fatalf("failed to get a value, got error: %v", err)
+	}
+
+	want := []azfunc.SBMsg{
+		{Data: "Message 1", MessageID: "id-1", DeliveryCount: 1, UserProperties: map[string]interface{}{"a": "b"}},
+		{Data: "Message 2", MessageID: "id-2", DeliveryCount: 3, UserProperties: map[string]interface{}{}},
+	}
+	if got := r.Interface(); !reflect.DeepEqual(got, want) {
+		t.Logf("got:  %+v\nwant: %+v", got, want)
+		t.Fail()
+	}
+}
+
+func TestConvertToTypeValue_SliceOfScalars(t *testing.T) {
+	r, err := convertToTypeValue(reflect.TypeOf([]string{}), jsonData(`["a", "b"]`), nil)
+	if err != nil {
+		t.Fatalf("failed to get a value, got error: %v", err)
+	}
+	if got, want := r.Interface(), []string{"a", "b"}; !reflect.DeepEqual(got, want) {
+		t.Logf("got:  %v\nwant: %v", got, want)
+		t.Fail()
+	}
+}
@@ -0,0 +1,61 @@
+package runtime
+
+import (
+	"strings"
+
+	"github.com/vladbarosan/func-go/internal/rpc"
+)
+
+// Capability names exchanged with the host during worker initialization
+const (
+	// RawHTTPBodyBytes means raw HTTP bodies can be exchanged as bytes instead of strings
+	RawHTTPBodyBytes = "RawHttpBodyBytes"
+	// WorkerStatus means the worker answers WorkerStatusRequest messages
+	WorkerStatus = "WorkerStatus"
+)
+
+// Capabilities contains the capabilities advertised by the host or the worker
+type Capabilities map[string]string
+
+// Has returns true if the capability is advertised and not explicitly disabled
+func (c Capabilities) Has(name string) bool {
+	v, ok := c[name]
+	return ok && !strings.EqualFold(v, "false")
+}
+
+// WorkerCapabilities returns the capabilities supported by this worker
+func WorkerCapabilities() Capabilities {
+	return Capabilities{
+		RawHTTPBodyBytes: "true",
+		WorkerStatus:     "true",
+	}
+}
+
+// HostInfo contains what the host sent in the worker init request
+type HostInfo struct {
+	Version       string
+	Capabilities  Capabilities
+	LogCategories map[string]rpc.RpcLog_Level
+}
+
+// logLevel returns the minimum level the host wants for a log category, checking the
+// category itself, then its parents and finally the host's Default category
+func (h *HostInfo) logLevel(category string) (rpc.RpcLog_Level, bool) {
+	if h == nil || len(h.LogCategories) == 0 {
+		return rpc.RpcLog_Trace, false
+	}
+
+	for c := category; c != ""; {
+		if l, ok := h.LogCategories[c]; ok {
+			return l, true
+		}
+		i := strings.LastIndex(c, ".")
+		if i < 0 {
+			break
+		}
+		c = c[:i]
+	}
+
+	l, ok := h.LogCategories["Default"]
+	return l, ok
+}
@@ -0,0 +1,63 @@
+package runtime
+
+import (
+	"testing"
+
+	"github.com/vladbarosan/func-go/internal/rpc"
+)
+
+func TestCapabilities_Has(t *testing.T) {
+	c := Capabilities{"enabled": "true", "set": "", "disabled": "False"}
+
+	testCases := []struct {
+		name string
+		want bool
+	}{
+		{"enabled", true},
+		{"set", true},
+		{"disabled", false},
+		{"missing", false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := c.Has(tc.name); got != tc.want {
+				t.Logf("got:  %t\nwant: %t", got, tc.want)
+				t.Fail()
+			}
+		})
+	}
+}
+
+func TestHostInfo_LogLevel(t *testing.T) {
+	h := &HostInfo{
+		LogCategories: map[string]rpc.RpcLog_Level{
+			"Default":          rpc.RpcLog_Warning,
+			"Function.Noisy":   rpc.RpcLog_Error,
+			"Function.Verbose": rpc.RpcLog_Trace,
+		},
+	}
+
+	testCases := []struct {
+		category string
+		want     rpc.RpcLog_Level
+	}{
+		{"Function.Noisy.User", rpc.RpcLog_Error},
+		{"Function.Verbose.User", rpc.RpcLog_Trace},
+		{"Function.Other.User", rpc.RpcLog_Warning},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.category, func(t *testing.T) {
+			got, ok := h.logLevel(tc.category)
+			if !ok || got != tc.want {
+				t.Logf("got:  %v\nwant: %v", got, tc.want)
+				t.Fail()
+			}
+		})
+	}
+
+	if _, ok := (&HostInfo{}).logLevel("Function.Any.User"); ok {
+		t.Errorf("expected no level without log categories")
+	}
+}
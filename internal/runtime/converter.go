@@ -6,11 +6,16 @@ import (
 	"fmt"
 	"io"
 	"io/ioutil"
+	"mime"
+	"net"
 	"net/http"
 	"reflect"
 	"strconv"
 	"strings"
+	"unicode/utf8"
 
+	"github.com/vladbarosan/func-go/azfunc"
+	"github.com/vladbarosan/func-go/internal/hosttime"
 	"github.com/vladbarosan/func-go/internal/rpc"
 	log "github.com/Sirupsen/logrus"
 )
@@ -43,42 +48,34 @@ func FromProto(req *rpc.InvocationRequest, fields map[string]*funcField) (map[st
 }
 
 //ToProto converts Values to grpc protocol results
-func ToProto(values []reflect.Value, fields map[string]*funcField) ([]*rpc.ParameterBinding, *rpc.TypedData, *rpc.StatusResult, error) {
-	protoData := make([]*rpc.ParameterBinding, len(fields))
+func ToProto(values []reflect.Value, fields map[string]*funcField, caps Capabilities) ([]*rpc.ParameterBinding, *rpc.TypedData, *rpc.StatusResult, error) {
+	protoData := make([]*rpc.ParameterBinding, 0, len(fields))
 	status := &rpc.StatusResult{
 		Status: rpc.StatusResult_Success,
 	}
 
-	for _, v := range fields {
-		b := values[v.Position]
-		d, err := encodeProto(b)
+	for _, v := range sortedFields(fields) {
+		b := resultValue(values, v)
+		d, err := encodeProto(b, caps)
 		if err != nil {
 			log.Debugf("failed to encode output binding :%s , %v:", v.Name, err)
 			d = &rpc.TypedData{}
 		}
-		protoData[v.Position] = &rpc.ParameterBinding{
+		protoData = append(protoData, &rpc.ParameterBinding{
 			Name: v.Name,
 			Data: d,
-		}
+		})
 	}
 
 	// Check if error is returned and set it as an exception
-	errIndex := -1
-	for k, v := range values {
-		if v.Kind() != reflect.Interface {
-			continue
-		}
-		e, ok := v.Interface().(error)
-		if ok {
-			log.Debugf("Found error output at index: %d parameter %s", k, e.Error())
-			errIndex = 1
-			status.Exception = &rpc.RpcException{
-				Message: e.Error(),
-				Source:  "User function",
-			}
-			status.Status = rpc.StatusResult_Failure
-			break
+	errIndex, e := funcError(values)
+	if e != nil {
+		log.Debugf("Found error output at index: %d parameter %s", errIndex, e.Error())
+		status.Exception = &rpc.RpcException{
+			Message: e.Error(),
+			Source:  "User function",
 		}
+		status.Status = rpc.StatusResult_Failure
 	}
 
 	// If there are named return values or no return values at all there is no return value
@@ -100,24 +97,59 @@ func ToProto(values []reflect.Value, fields map[string]*funcField) ([]*rpc.Param
 	}
 
 	log.Debugf("return params and not out params: %v", values[i].Interface())
-	rv, err := encodeProto(values[i])
+	rv, err := encodeProto(values[i], caps)
 	return protoData, rv, status, err
 }
 
-//encodeProto returns protobuf value from a native value
-func encodeProto(v reflect.Value) (*rpc.TypedData, error) {
+// funcError returns the non-nil error returned by a function and its position, or -1 and nil
+func funcError(values []reflect.Value) (int, error) {
+	for k, v := range values {
+		if v.Kind() != reflect.Interface {
+			continue
+		}
+		if e, ok := v.Interface().(error); ok {
+			return k, e
+		}
+	}
+	return -1, nil
+}
+
+//encodeProto returns protobuf value from a native value, using the capabilities of the host
+func encodeProto(v reflect.Value, caps Capabilities) (*rpc.TypedData, error) {
+
+	if v.Kind() == reflect.Interface && !v.IsNil() {
+		v = v.Elem()
+	}
+
+	if d, ok, err := encodeCustom(v); ok {
+		return d, err
+	}
+
+	// readers usually have pointer receivers, like *bytes.Buffer and *os.File
+	if v.Kind() != reflect.Ptr || !v.IsNil() {
+		if d, ok, err := encodeStream(v); ok {
+			return d, err
+		}
+	}
 
 	if v.Type().Kind() == reflect.Ptr {
 		if v.IsNil() {
 			return &rpc.TypedData{}, nil
 		}
-		log.Debugf("encoding pointer %s", v.Type().Name)
+		log.Debugf("encoding pointer %s", v.Type().Name())
 		v = v.Elem()
+		if d, ok, err := encodeCustom(v); ok {
+			return d, err
+		}
+	}
+
+	if d, ok, err := encodeNumber(v); ok {
+		return d, err
 	}
 
 	switch tv := v.Interface().(type) {
 	case http.Response:
-		resp, err := encodeHTTP(&tv)
+		resp, err := encodeHTTP(&tv, caps)
 		if err != nil {
 			log.Debugf("failed to encode http, %v:", err)
 			return nil, err
@@ -143,6 +175,13 @@ func encodeProto(v reflect.Value) (*rpc.TypedData, error) {
 // convertToTypeValue returns a native value from protobuf
 func convertToTypeValue(pt reflect.Type, data *rpc.TypedData, tm map[string]*rpc.TypedData) (reflect.Value, error) {
 
+	if d, ok, err := decodeCustom(pt, data, tm); ok {
+		return d, err
+	}
+	if d, ok, err := decodeBatch(pt, data, tm); ok {
+		return d, err
+	}
+
 	var t reflect.Type
 
 	log.Debugf("pt %s", pt)
@@ -156,18 +195,20 @@ func convertToTypeValue(pt reflect.Type, data *rpc.TypedData, tm map[string]*rpc
 	pv := reflect.New(t)
 	v := pv.Elem()
 	c := 0
+	dataBound := false
 	log.Debugf("Converting to type %s", t)
-	log.Debugf("invocation metadata fields: %v", t, tm)
+	log.Debugf("invocation metadata fields: %v", tm)
 
 	for i := 0; t.Kind() == reflect.Struct && i < v.NumField(); i++ {
 		tag := t.Field(i).Tag.Get("json")
-		log.Debugf("Decoding field: %s, tag: %s", t.Field(i), tag)
+		log.Debugf("Decoding field: %s, tag: %s", t.Field(i).Name, tag)
 
 		var td *rpc.TypedData
 
 		if strings.EqualFold(tag, "azfuncdata") {
 			log.Debugf("Decoding runtime input data")
 			td = data
+			dataBound = true
 			c++
 		} else if _, ok := tm[tag]; ok {
 			td = tm[tag]
@@ -178,6 +219,15 @@ func convertToTypeValue(pt reflect.Type, data *rpc.TypedData, tm map[string]*rpc
 			continue
 		}
 
+		// dates of the metadata are kept as the host sent them and never fail the invocation
+		if t.Field(i).Type == timeType && td != data {
+			if text, ok := stringText(td); ok {
+				hosttime.Keep(pv.Interface(), tag, text)
+				v.Field(i).Set(reflect.ValueOf(hosttime.Field(t.Field(i).Name, text)))
+				continue
+			}
+		}
+
 		d, err := decodeProto(td, t.Field(i).Type)
 
 		if err != nil {
@@ -187,7 +237,8 @@ func convertToTypeValue(pt reflect.Type, data *rpc.TypedData, tm map[string]*rpc
 		v.Field(i).Set(d)
 	}
 
-	if t.Kind() != reflect.Struct || c < t.NumField() {
+	// the data is the content of one field when it is bound to it, the missing fields are just not in the metadata
+	if t.Kind() != reflect.Struct || (c < t.NumField() && !dataBound) {
 		log.Debugf("Binding type does not have any tags, decoding directly into the type")
 		d, err := decodeProto(data, t)
 		if err != nil {
@@ -206,11 +257,25 @@ func convertToTypeValue(pt reflect.Type, data *rpc.TypedData, tm map[string]*rpc
 	return v, nil
 }
 
+// stringText returns the text of d if it is a string or a JSON string
+func stringText(d *rpc.TypedData) (string, bool) {
+	switch d.Data.(type) {
+	case *rpc.TypedData_String_:
+		return d.GetString_(), true
+	case *rpc.TypedData_Json:
+		return jsonString(d.GetJson())
+	}
+	return "", false
+}
+
 //decodeProto returns a native value from a protobuf value
-func decodeProto(d *rpc.TypedData, ft reflect.Type) (rv reflect.Value, err error) {
+func decodeProto(d *rpc.TypedData, ft reflect.Type) (reflect.Value, error) {
 
-	if (d == nil || d.Data == nil) && ft.Kind() == reflect.Ptr {
-		return reflect.Zero(ft), nil
+	if d == nil || d.Data == nil {
+		if ft.Kind() == reflect.Ptr {
+			return reflect.Zero(ft), nil
+		}
+		return reflect.Value{}, fmt.Errorf("Cannot decode to type %s from empty data", ft)
 	}
 
 	var t reflect.Type
@@ -220,9 +285,31 @@ func decodeProto(d *rpc.TypedData, ft reflect.Type) (rv reflect.Value, err error
 		t = ft
 	}
 
+	// byte slices and readers get the data as it was sent, without decoding JSON or base64
+	if t == bytesType || isReaderType(t) {
+		if b, ok := dataBytes(d); ok {
+			return wrapValue(decodeBytes(b, t), ft), nil
+		}
+	}
+
 	var cv reflect.Value
+	var err error
 	switch d.Data.(type) {
 	case *rpc.TypedData_Json:
+		// scalars sent as JSON strings, like dates in trigger metadata, use the same rules as protobuf strings
+		if s, ok := jsonString(d.GetJson()); ok && isScalar(t) {
+			cv, err = decodeString(s, t)
+			break
+		}
+		// strings receive JSON documents as they are, like event bodies in a batch
+		if t.Kind() == reflect.String && isJSONDocument([]byte(d.GetJson())) {
+			cv = reflect.ValueOf(d.GetJson())
+			break
+		}
+		// null is the zero value, like a missing partition key in a batch
+		if strings.TrimSpace(d.GetJson()) == "null" {
+			return reflect.Zero(ft), nil
+		}
 		vp := reflect.New(t).Interface()
 		if err := json.Unmarshal([]byte(d.GetJson()), &vp); err != nil {
 			return reflect.Value{}, err
@@ -230,21 +317,11 @@ func decodeProto(d *rpc.TypedData, ft reflect.Type) (rv reflect.Value, err error
 		log.Debugf("Converted to type %s and content %v", t, vp)
 		cv = reflect.ValueOf(vp).Elem()
 	case *rpc.TypedData_String_:
-		var v reflect.Value
-		var err error
-		switch t.Kind() {
-		case reflect.Int:
-			var c int
-			c, err = strconv.Atoi(d.GetString_())
-			if err == nil {
-				v = reflect.ValueOf(c)
-			}
-		case reflect.String:
-			v = reflect.ValueOf(d.GetString_())
-		default:
-			err = fmt.Errorf("Cannot convert protobuf string to type: %v", t)
-		}
-		cv = v
+		cv, err = decodeString(d.GetString_(), t)
+	case *rpc.TypedData_Int:
+		cv, err = decodeInt(d.GetInt(), t)
+	case *rpc.TypedData_Double:
+		cv, err = decodeDouble(d.GetDouble(), t)
 	case *rpc.TypedData_Http:
 		cv, err = decodeHTTP(d.GetHttp())
 	case *rpc.TypedData_Bytes:
@@ -252,49 +329,141 @@ func decodeProto(d *rpc.TypedData, ft reflect.Type) (rv reflect.Value, err error
 	case *rpc.TypedData_Stream:
 		cv = reflect.ValueOf(d.GetStream())
 	default:
-		err = fmt.Errorf("Cannot decode to type %s from data: %v", t.Name(), d)
+		err = fmt.Errorf("unknown data type %T", d.Data)
 	}
 
 	if err != nil {
-		return reflect.Value{}, fmt.Errorf("Cannot decode to type %s from data: %v", t.Name(), d)
+		return reflect.Value{}, fmt.Errorf("Cannot decode to type %s from data: %v: %v", t, d, err)
+	}
+	if !cv.Type().ConvertibleTo(t) {
+		return reflect.Value{}, fmt.Errorf("Cannot decode to type %s from data: %v", t, d)
 	}
 
-	cv = cv.Convert(t)
+	return wrapValue(cv.Convert(t), ft), nil
+}
 
-	if ft.Kind() == reflect.Ptr {
-		rv := reflect.New(ft)
-		rv.Elem().Set(cv)
-	} else {
-		rv = cv
+// wrapValue returns v, or a pointer to a copy of v if ft is a pointer type
+func wrapValue(v reflect.Value, ft reflect.Type) reflect.Value {
+	if ft.Kind() != reflect.Ptr {
+		return v
 	}
-	return
+	pv := reflect.New(ft.Elem())
+	pv.Elem().Set(v)
+	return pv
 }
 
-// encodeHTTP returns a protobuf Http type from a *http.Response
-func encodeHTTP(r *http.Response) (*rpc.RpcHttp, error) {
+// encodeHTTP returns a protobuf Http type from a *http.Response.
+// Bodies that are not text are sent as bytes when the host accepts them.
+// The host takes a single value per header, so a response can set only one cookie.
+func encodeHTTP(r *http.Response, caps Capabilities) (*rpc.RpcHttp, error) {
 	resp := &rpc.RpcHttp{}
-	body, err := ioutil.ReadAll(r.Body)
-	if err != nil {
-		return nil, err
+
+	var body []byte
+	if r.Body != nil {
+		defer r.Body.Close()
+		b, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			return nil, err
+		}
+		body = b
 	}
 
-	resp.RawBody = &rpc.TypedData{
-		Data: &rpc.TypedData_String_{
-			String_: string(body),
-		},
+	// the host only knows headers, trailers are available once the body is read and are sent with them
+	header := make(http.Header, len(r.Header)+len(r.Trailer))
+	for key, values := range r.Header {
+		if http.CanonicalHeaderKey(key) != "Trailer" {
+			header[key] = values
+		}
+	}
+	for key, values := range r.Trailer {
+		header[key] = append(header[key], values...)
+	}
+
+	contentType := header.Get("Content-Type")
+	resp.RawBody = encodeHTTPBody(body, contentType, caps)
+	resp.Body = encodeHTTPBody(body, contentType, caps)
+
+	// without an explicit content type, JSON bodies are formatted by the host for the Accept header of the client
+	if contentType == "" && isJSONDocument(body) {
+		resp.Body = &rpc.TypedData{
+			Data: &rpc.TypedData_Json{
+				Json: string(body),
+			},
+		}
+		resp.EnableContentNegotiation = true
+	}
+
+	resp.Headers = make(map[string]string, len(header))
+	for key, values := range header {
+		// the host takes one value per header and cookies cannot be joined like other values
+		if http.CanonicalHeaderKey(key) == "Set-Cookie" && len(values) > 1 {
+			return nil, fmt.Errorf("cannot send %d Set-Cookie headers, the host accepts one per response", len(values))
+		}
+		if len(values) > 0 {
+			resp.Headers[key] = strings.Join(values, ", ")
+		}
+	}
+
+	status := r.StatusCode
+	if status == 0 {
+		status = http.StatusOK
 	}
-	// For now return body as a string also
-	resp.Body = &rpc.TypedData{
+	resp.StatusCode = strconv.Itoa(status)
+	return resp, nil
+}
+
+// isJSONDocument returns true if body is a JSON object or array
+func isJSONDocument(body []byte) bool {
+	b := bytes.TrimSpace(body)
+	return len(b) > 0 && (b[0] == '{' || b[0] == '[') && json.Valid(b)
+}
+
+// encodeHTTPBody returns body as a string if it is text or if the host does not accept bytes
+func encodeHTTPBody(body []byte, contentType string, caps Capabilities) *rpc.TypedData {
+	if !isText(body, contentType) && caps.Has(RawHTTPBodyBytes) {
+		return &rpc.TypedData{
+			Data: &rpc.TypedData_Bytes{
+				Bytes: body,
+			},
+		}
+	}
+	return &rpc.TypedData{
 		Data: &rpc.TypedData_String_{
 			String_: string(body),
 		},
 	}
-	resp.Headers = make(map[string]string, len(r.Header))
-	for key, value := range r.Header {
-		resp.Headers[key] = strings.Join(value, ",")
+}
+
+// isText returns true if a body of the given content type can be sent as a string without loss.
+// Strings are UTF-8 on the wire, so bodies in other encodings are sent as bytes whatever their content type.
+func isText(body []byte, contentType string) bool {
+	if !utf8.Valid(body) {
+		return false
+	}
+	if contentType == "" {
+		return true
+	}
+
+	mt, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return true
+	}
+	if _, ok := params["charset"]; ok {
+		return true
+	}
+
+	switch {
+	case strings.HasPrefix(mt, "text/"),
+		strings.HasSuffix(mt, "+json"),
+		strings.HasSuffix(mt, "+xml"):
+		return true
+	}
+	switch mt {
+	case "application/json", "application/xml", "application/javascript", "application/x-www-form-urlencoded":
+		return true
+	default:
+		return false
 	}
-	resp.StatusCode = strconv.Itoa(r.StatusCode)
-	return resp, nil
 }
 
 // decodeHTTP returns a native http.Request from a typed data
@@ -304,12 +473,12 @@ func decodeHTTP(d *rpc.RpcHttp) (reflect.Value, error) {
 		return reflect.Value{}, fmt.Errorf("cannot convert nil request")
 	}
 
+	// the raw body is exactly what the client sent, the body may have been parsed by the host
 	var body io.Reader
-	if d.RawBody != nil {
-		switch d := d.RawBody.Data.(type) {
-		case *rpc.TypedData_String_:
-			body = ioutil.NopCloser(bytes.NewBufferString(d.String_))
-		}
+	if b, ok := dataBytes(d.GetRawBody()); ok {
+		body = bytes.NewReader(b)
+	} else if b, ok := dataBytes(d.GetBody()); ok {
+		body = bytes.NewReader(b)
 	}
 
 	req, err := http.NewRequest(d.GetMethod(), d.GetUrl(), body)
@@ -318,9 +487,93 @@ func decodeHTTP(d *rpc.RpcHttp) (reflect.Value, error) {
 		return reflect.Value{}, err
 	}
 
+	// the host sends the query separately too, keep parameters it parsed that are missing from the URL
+	if len(d.GetQuery()) > 0 {
+		q := req.URL.Query()
+		for key, value := range d.GetQuery() {
+			if _, ok := q[key]; !ok {
+				q.Set(key, value)
+			}
+		}
+		req.URL.RawQuery = q.Encode()
+	}
+	req.RequestURI = req.URL.RequestURI()
+
 	for key, value := range d.GetHeaders() {
-		req.Header.Set(key, value)
+		for _, v := range splitHeader(key, value) {
+			req.Header.Add(key, v)
+		}
+	}
+
+	// like the server side of net/http, the Host header is moved to the Host field
+	if host := req.Header.Get("Host"); host != "" {
+		req.Host = host
+		req.Header.Del("Host")
 	}
+	req.RemoteAddr = remoteAddr(req.Header)
+	req = req.WithContext(azfunc.WithRouteParams(req.Context(), d.GetParams()))
 
 	return reflect.ValueOf(req).Elem(), nil
 }
+
+// listHeaders are the headers whose comma separated elements cannot contain commas themselves
+var listHeaders = map[string]bool{
+	"Accept":            true,
+	"Accept-Charset":    true,
+	"Accept-Encoding":   true,
+	"Accept-Language":   true,
+	"Allow":             true,
+	"Cache-Control":     true,
+	"Connection":        true,
+	"Content-Encoding":  true,
+	"If-Match":          true,
+	"If-None-Match":     true,
+	"Pragma":            true,
+	"Te":                true,
+	"Trailer":           true,
+	"Transfer-Encoding": true,
+	"Upgrade":           true,
+	"Vary":              true,
+	"Via":               true,
+	"X-Forwarded-For":   true,
+	"X-Forwarded-Host":  true,
+	"X-Forwarded-Proto": true,
+}
+
+// splitHeader returns the values the host joined into a single header value
+func splitHeader(key, value string) []string {
+	var sep string
+	switch key = http.CanonicalHeaderKey(key); {
+	case key == "Cookie":
+		// cookie values cannot contain commas, so cookies joined with either separator are split
+		value = strings.Replace(value, ",", ";", -1)
+		sep = ";"
+	case listHeaders[key]:
+		sep = ","
+	default:
+		return []string{value}
+	}
+
+	var values []string
+	for _, v := range strings.Split(value, sep) {
+		if v = strings.TrimSpace(v); v != "" {
+			values = append(values, v)
+		}
+	}
+	if key == "Cookie" {
+		return []string{strings.Join(values, "; ")}
+	}
+	return values
+}
+
+// remoteAddr returns the address of the client from the forwarding headers of the host, as host:port
+func remoteAddr(h http.Header) string {
+	addr := h.Get("X-Forwarded-For")
+	if addr == "" {
+		return ""
+	}
+	if _, _, err := net.SplitHostPort(addr); err == nil {
+		return addr
+	}
+	return net.JoinHostPort(strings.Trim(addr, "[]"), "0")
+}
@@ -4,15 +4,20 @@ import (
 	"bytes"
 	"encoding/json"
 	"fmt"
+	"io"
 	"io/ioutil"
+	"math"
 	"net/http"
+	"net/url"
 	"path/filepath"
 	"reflect"
 	"testing"
+	"time"
 
 	"github.com/vladbarosan/func-go/azfunc"
 	"github.com/vladbarosan/func-go/internal/rpc"
 	"github.com/golang/protobuf/jsonpb"
+	"github.com/golang/protobuf/proto"
 )
 
 func TestConvertToTypeValue_HttpRequest(t *testing.T) {
@@ -157,6 +162,14 @@ func TestConvertToTypeValue_Timer(t *testing.T) {
 				t.Logf("got:  %t\nwant: %t", got, want)
 				t.Fail()
 			}
+			if got, want := v.ScheduleStats.Next, time.Date(2018, 7, 18, 1, 45, 0, 0, time.UTC); !got.Equal(want) {
+				t.Logf("got:  %v\nwant: %v", got, want)
+				t.Fail()
+			}
+			if got, want := v.ScheduleStats.LastString(), "2018-07-18T01:44:03.4355015+00:00"; got != want {
+				t.Logf("got:  %q\nwant: %q", got, want)
+				t.Fail()
+			}
 		})
 	}
 }
@@ -242,17 +255,31 @@ func TestConvertToTypeValue_QueueMsg(t *testing.T) {
 				v = r.Interface().(azfunc.QueueMsg)
 			}
 
+			times := []struct{ got, want string }{
+				{v.ExpirationString(), "2018-07-25T08:15:08+00:00"},
+				{v.InsertionString(), "2018-07-18T08:15:08+00:00"},
+				{v.NextVisibleString(), "2018-07-18T08:25:15+00:00"},
+			}
+			for _, tm := range times {
+				if tm.got != tm.want {
+					t.Logf("got:  %q\nwant: %q", tm.got, tm.want)
+					t.Fail()
+				}
+			}
+			if got, want := v.TimeToLive(), 7*24*time.Hour; got != want {
+				t.Logf("got:  %v\nwant: %v", got, want)
+				t.Fail()
+			}
+			v.Expiration, v.Insertion, v.NextVisible = time.Time{}, time.Time{}, time.Time{}
+
 			expectedQueueMsg := azfunc.QueueMsg{
 				ID:           "38c00d86-c30c-4a48-aff5-deafb4b273e4",
 				DequeueCount: 1,
-				Expiration:   "2018-07-25T08:15:08+00:00",
-				Insertion:    "2018-07-18T08:15:08+00:00",
-				NextVisible:  "2018-07-18T08:25:15+00:00",
 				PopReceipt:   "AgAAAAMAAAAAAAAASsWZ2nAe1AE=",
 				Text:         "test queue msg",
 			}
 
-			if got, want := v, expectedQueueMsg; got != want {
+			if got, want := exportedFields(v), exportedFields(expectedQueueMsg); !reflect.DeepEqual(got, want) {
 				t.Logf("got:  %v\nwant: %v", got, want)
 				t.Fail()
 			}
@@ -290,19 +317,27 @@ func TestConvertToTypeValue_ServiceBusMsg(t *testing.T) {
 				v = r.Interface().(azfunc.SBMsg)
 			}
 
+			if got, want := v.ExpiresAtUtcString(), "2018-07-31T23:54:18.288Z"; got != want {
+				t.Logf("got:  %q\nwant: %q", got, want)
+				t.Fail()
+			}
+			if got, want := v.EnqueuedTimeUtcString(), "2018-07-30T23:54:18.288Z"; got != want {
+				t.Logf("got:  %q\nwant: %q", got, want)
+				t.Fail()
+			}
+			v.ExpiresAtUtc, v.EnqueuedTimeUtc = time.Time{}, time.Time{}
+
 			expectedQueueMsg := azfunc.SBMsg{
-				Data:            "Message 1",
-				MessageID:       "429c66a736a94a2e8c6e2783e568d460",
-				DeliveryCount:   7,
-				ExpiresAtUtc:    "2018-07-31T23:54:18.288Z",
-				EnqueuedTimeUtc: "2018-07-30T23:54:18.288Z",
-				SequenceNumber:  281474976710657,
+				Data:           "Message 1",
+				MessageID:      "429c66a736a94a2e8c6e2783e568d460",
+				DeliveryCount:  7,
+				SequenceNumber: 281474976710657,
 				UserProperties: map[string]interface{}{
 					"x-opt-enqueue-sequence-number": float64(0),
 				},
 			}
 
-			if got, want := v, expectedQueueMsg; !reflect.DeepEqual(got, want) {
+			if got, want := exportedFields(v), exportedFields(expectedQueueMsg); !reflect.DeepEqual(got, want) {
 				t.Logf("got:  %v\nwant: %v", got, want)
 				t.Fail()
 			}
@@ -355,10 +390,15 @@ func TestConvertToTypeValue_EventGridEvent(t *testing.T) {
 				"clientRequestId": "58648a86-5e00-49fc-b1b1-e9bd6e98a025",
 			}
 
+			if got, want := v.EventTimeString(), "2018-07-04T01:43:58.6171715Z"; got != want {
+				t.Logf("got:  %q\nwant: %q", got, want)
+				t.Fail()
+			}
+			v.EventTime = time.Time{}
+
 			expected := azfunc.EventGridEvent{
 				Data:            data,
 				DataVersion:     "",
-				EventTime:       "2018-07-04T01:43:58.6171715Z",
 				EventType:       "Microsoft.Storage.BlobCreated",
 				ID:              "71fd4516-701e-005b-0b38-135eb80633b3",
 				MetadataVersion: "1",
@@ -366,7 +406,72 @@ func TestConvertToTypeValue_EventGridEvent(t *testing.T) {
 				Topic:           "/subscriptions/7127e532-e730-40dd-acda-0ca1105c1e55/resourceGroups/valddFunctionGo/providers/Microsoft.Storage/storageAccounts/vladdbblobstorage",
 			}
 
-			if got, want := v, expected; !reflect.DeepEqual(got, want) {
+			if got, want := exportedFields(v), exportedFields(expected); !reflect.DeepEqual(got, want) {
+				t.Logf("got:  %v\nwant: %v", got, want)
+				t.Fail()
+			}
+		})
+	}
+}
+
+func TestDecodeProto_Numeric(t *testing.T) {
+	intData := func(i int64) *rpc.TypedData { return &rpc.TypedData{Data: &rpc.TypedData_Int{Int: i}} }
+	doubleData := func(f float64) *rpc.TypedData { return &rpc.TypedData{Data: &rpc.TypedData_Double{Double: f}} }
+	i := 42
+
+	testCases := []struct {
+		name    string
+		data    *rpc.TypedData
+		typ     reflect.Type
+		want    interface{}
+		wantErr bool
+	}{
+		{"int to int", intData(-42), reflect.TypeOf(int(0)), int(-42), false},
+		{"int to int8", intData(127), reflect.TypeOf(int8(0)), int8(127), false},
+		{"int overflows int8", intData(128), reflect.TypeOf(int8(0)), nil, true},
+		{"int to int16", intData(-32768), reflect.TypeOf(int16(0)), int16(-32768), false},
+		{"int to int32", intData(1 << 30), reflect.TypeOf(int32(0)), int32(1 << 30), false},
+		{"int to int64", intData(math.MinInt64), reflect.TypeOf(int64(0)), int64(math.MinInt64), false},
+		{"int to uint", intData(42), reflect.TypeOf(uint(0)), uint(42), false},
+		{"negative int to uint", intData(-1), reflect.TypeOf(uint(0)), nil, true},
+		{"int to uint8", intData(255), reflect.TypeOf(uint8(0)), uint8(255), false},
+		{"int overflows uint16", intData(1 << 16), reflect.TypeOf(uint16(0)), nil, true},
+		{"int to uint32", intData(1 << 31), reflect.TypeOf(uint32(0)), uint32(1 << 31), false},
+		{"int to uint64", intData(math.MaxInt64), reflect.TypeOf(uint64(0)), uint64(math.MaxInt64), false},
+		{"int to float32", intData(3), reflect.TypeOf(float32(0)), float32(3), false},
+		{"int to float64", intData(3), reflect.TypeOf(float64(0)), float64(3), false},
+		{"int to string", intData(42), reflect.TypeOf(""), "42", false},
+		{"int to interface", intData(42), reflect.TypeOf((*interface{})(nil)).Elem(), int64(42), false},
+		{"int to pointer", intData(42), reflect.TypeOf(&i), &i, false},
+		{"int to bool", intData(1), reflect.TypeOf(false), nil, true},
+		{"double to float64", doubleData(1.5), reflect.TypeOf(float64(0)), float64(1.5), false},
+		{"double to float32", doubleData(-1.5), reflect.TypeOf(float32(0)), float32(-1.5), false},
+		{"double overflows float32", doubleData(math.MaxFloat64), reflect.TypeOf(float32(0)), nil, true},
+		{"whole double to int", doubleData(-7), reflect.TypeOf(int(0)), int(-7), false},
+		{"fractional double to int", doubleData(7.5), reflect.TypeOf(int(0)), nil, true},
+		{"double overflows int8", doubleData(300), reflect.TypeOf(int8(0)), nil, true},
+		{"double overflows int64", doubleData(1e19), reflect.TypeOf(int64(0)), nil, true},
+		{"whole double to uint32", doubleData(7), reflect.TypeOf(uint32(0)), uint32(7), false},
+		{"negative double to uint", doubleData(-7), reflect.TypeOf(uint(0)), nil, true},
+		{"double to interface", doubleData(1.5), reflect.TypeOf((*interface{})(nil)).Elem(), float64(1.5), false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			v, err := decodeProto(tc.data, tc.typ)
+			if tc.wantErr {
+				if err == nil {
+					t.Fatalf("expected an error, got value: %v", v)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("failed to decode, got error: %v", err)
+			}
+			if got := v.Type(); got != tc.typ {
+				t.Fatalf("got:  %v\nwant: %v", got, tc.typ)
+			}
+			if got, want := v.Interface(), tc.want; !reflect.DeepEqual(got, want) {
 				t.Logf("got:  %v\nwant: %v", got, want)
 				t.Fail()
 			}
@@ -374,6 +479,63 @@ func TestConvertToTypeValue_EventGridEvent(t *testing.T) {
 	}
 }
 
+// level is an enum encoded by name
+type level int
+
+func (l level) MarshalJSON() ([]byte, error) {
+	return json.Marshal([]string{"info", "warning", "error"}[l])
+}
+
+// code is a number encoded as text
+type code uint16
+
+func (c code) MarshalText() ([]byte, error) {
+	return []byte(fmt.Sprintf("E%03d", uint16(c))), nil
+}
+
+func TestEncodeProto_Numeric(t *testing.T) {
+	f := 2.5
+	testCases := []struct {
+		name    string
+		value   interface{}
+		want    *rpc.TypedData
+		wantErr bool
+	}{
+		{"int", int(-42), &rpc.TypedData{Data: &rpc.TypedData_Int{Int: -42}}, false},
+		{"int8", int8(-8), &rpc.TypedData{Data: &rpc.TypedData_Int{Int: -8}}, false},
+		{"int64", int64(math.MaxInt64), &rpc.TypedData{Data: &rpc.TypedData_Int{Int: math.MaxInt64}}, false},
+		{"uint16", uint16(16), &rpc.TypedData{Data: &rpc.TypedData_Int{Int: 16}}, false},
+		{"uint64", uint64(math.MaxInt64), &rpc.TypedData{Data: &rpc.TypedData_Int{Int: math.MaxInt64}}, false},
+		{"uint64 overflow", uint64(math.MaxUint64), nil, true},
+		{"float32", float32(0.5), &rpc.TypedData{Data: &rpc.TypedData_Double{Double: 0.5}}, false},
+		{"float64", float64(-1.25), &rpc.TypedData{Data: &rpc.TypedData_Double{Double: -1.25}}, false},
+		{"float64 pointer", &f, &rpc.TypedData{Data: &rpc.TypedData_Double{Double: 2.5}}, false},
+		{"string", "42", &rpc.TypedData{Data: &rpc.TypedData_Json{Json: `"42"`}}, false},
+		{"json marshaler", level(1), &rpc.TypedData{Data: &rpc.TypedData_Json{Json: `"warning"`}}, false},
+		{"text marshaler", code(7), &rpc.TypedData{Data: &rpc.TypedData_Json{Json: `"E007"`}}, false},
+		{"duration", time.Second, &rpc.TypedData{Data: &rpc.TypedData_Json{Json: "1000000000"}}, false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := encodeProto(reflect.ValueOf(tc.value), nil)
+			if tc.wantErr {
+				if err == nil {
+					t.Fatalf("expected an error, got: %v", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("failed to encode, got error: %v", err)
+			}
+			if !proto.Equal(got, tc.want) {
+				t.Logf("got:  %v\nwant: %v", got, tc.want)
+				t.Fail()
+			}
+		})
+	}
+}
+
 func loadTestData(t *testing.T, name string) []byte {
 	path := filepath.Join("testdata", name) // relative path
 	bytes, err := ioutil.ReadFile(path)
@@ -391,3 +553,458 @@ func loadInvocationRequest(t *testing.T, name string) *rpc.InvocationRequest {
 	jsonpb.Unmarshal(r, &ir)
 	return &ir
 }
+
+// exportedFields returns the exported fields of the struct v by name, without the state kept by the azfunc types
+func exportedFields(v interface{}) map[string]interface{} {
+	rv := reflect.ValueOf(v)
+	fields := map[string]interface{}{}
+	for i := 0; i < rv.NumField(); i++ {
+		if f := rv.Type().Field(i); f.PkgPath == "" {
+			fields[f.Name] = rv.Field(i).Interface()
+		}
+	}
+	return fields
+}
+
+func TestConvertToTypeValue_RawTimes(t *testing.T) {
+	t.Run("queue message", func(t *testing.T) {
+		r, err := convertToTypeValue(reflect.TypeOf(azfunc.QueueMsg{}), &rpc.TypedData{Data: &rpc.TypedData_String_{String_: "msg"}}, map[string]*rpc.TypedData{
+			"InsertionTime":   jsonData(`"2018-07-18T08:15:08.1000000+00:00"`),
+			"ExpirationTime":  {Data: &rpc.TypedData_String_{String_: "sometime next week"}},
+			"NextVisibleTime": jsonData(`"2018-07-18T08:25:15Z"`),
+		})
+		if err != nil {
+			t.Fatalf("failed to get a value, got error: %v", err)
+		}
+		v := r.Interface().(azfunc.QueueMsg)
+
+		if got, want := v.Insertion, time.Date(2018, 7, 18, 8, 15, 8, 100000000, time.UTC); !got.Equal(want) {
+			t.Logf("got:  %v\nwant: %v", got, want)
+			t.Fail()
+		}
+		if !v.Expiration.IsZero() {
+			t.Errorf("expected a zero time for an unparsable date, got: %v", v.Expiration)
+		}
+
+		times := []struct{ got, want string }{
+			{v.InsertionString(), "2018-07-18T08:15:08.1000000+00:00"},
+			{v.ExpirationString(), "sometime next week"},
+			{v.NextVisibleString(), "2018-07-18T08:25:15Z"},
+		}
+		for _, tm := range times {
+			if tm.got != tm.want {
+				t.Logf("got:  %q\nwant: %q", tm.got, tm.want)
+				t.Fail()
+			}
+		}
+	})
+
+	t.Run("event grid event", func(t *testing.T) {
+		r, err := convertToTypeValue(reflect.TypeOf(azfunc.EventGridEvent{}), jsonData(`{"id": "1", "eventTime": "04/07/2018 01:43:58"}`), nil)
+		if err != nil {
+			t.Fatalf("failed to get a value, got error: %v", err)
+		}
+		v := r.Interface().(azfunc.EventGridEvent)
+
+		if !v.EventTime.IsZero() {
+			t.Errorf("expected a zero time for an unparsable date, got: %v", v.EventTime)
+		}
+		if got, want := v.EventTimeString(), "04/07/2018 01:43:58"; got != want {
+			t.Logf("got:  %q\nwant: %q", got, want)
+			t.Fail()
+		}
+		if got, want := v.ID, "1"; got != want {
+			t.Logf("got:  %q\nwant: %q", got, want)
+			t.Fail()
+		}
+	})
+
+	t.Run("schedule without offsets", func(t *testing.T) {
+		r, err := convertToTypeValue(reflect.TypeOf(azfunc.Timer{}), jsonData(`{"ScheduleStatus": {"Last": "2018-07-18T01:44:03.4355015", "Next": "/Date(1531878300000)/", "LastUpdated": "soon"}}`), nil)
+		if err != nil {
+			t.Fatalf("failed to get a value, got error: %v", err)
+		}
+		v := r.Interface().(azfunc.Timer).ScheduleStats
+
+		if got, want := v.Last, time.Date(2018, 7, 18, 1, 44, 3, 435501500, time.UTC); !got.Equal(want) {
+			t.Logf("got:  %v\nwant: %v", got, want)
+			t.Fail()
+		}
+		if got, want := v.Next, time.Date(2018, 7, 18, 1, 45, 0, 0, time.UTC); !got.Equal(want) {
+			t.Logf("got:  %v\nwant: %v", got, want)
+			t.Fail()
+		}
+		if !v.LastUpdated.IsZero() {
+			t.Errorf("expected a zero time for an unparsable date, got: %v", v.LastUpdated)
+		}
+		if got, want := v.LastString(), "2018-07-18T01:44:03.4355015"; got != want {
+			t.Logf("got:  %q\nwant: %q", got, want)
+			t.Fail()
+		}
+		if got, want := v.LastUpdatedString(), "soon"; got != want {
+			t.Logf("got:  %q\nwant: %q", got, want)
+			t.Fail()
+		}
+	})
+
+	t.Run("user type", func(t *testing.T) {
+		type delivery struct {
+			Data    string    `json:"azfuncdata"`
+			Sent    time.Time `json:"SentTime"`
+			Arrival time.Time `json:"ArrivalTime"`
+		}
+		r, err := convertToTypeValue(reflect.TypeOf(delivery{}), &rpc.TypedData{Data: &rpc.TypedData_String_{String_: "msg"}}, map[string]*rpc.TypedData{
+			"SentTime":    jsonData(`"7/18/2018 8:15:08 AM"`),
+			"ArrivalTime": {Data: &rpc.TypedData_String_{String_: "sometime next week"}},
+		})
+		if err != nil {
+			t.Fatalf("failed to get a value, got error: %v", err)
+		}
+		v := r.Interface().(delivery)
+
+		if got, want := v.Sent, time.Date(2018, 7, 18, 8, 15, 8, 0, time.UTC); !got.Equal(want) {
+			t.Logf("got:  %v\nwant: %v", got, want)
+			t.Fail()
+		}
+		if !v.Arrival.IsZero() {
+			t.Errorf("expected a zero time for an unparsable date, got: %v", v.Arrival)
+		}
+	})
+
+	t.Run("built by the function", func(t *testing.T) {
+		v := azfunc.SBMsg{ExpiresAtUtc: time.Date(2018, 7, 31, 23, 54, 18, 288000000, time.UTC)}
+		if got, want := v.ExpiresAtUtcString(), "2018-07-31T23:54:18.288Z"; got != want {
+			t.Logf("got:  %q\nwant: %q", got, want)
+			t.Fail()
+		}
+		if got := v.EnqueuedTimeUtcString(); got != "" {
+			t.Errorf("expected no string for a zero time, got: %q", got)
+		}
+	})
+}
+
+func TestDecodeHTTP_BinaryBody(t *testing.T) {
+	for _, fixture := range []string{"pixel.png", "payload.gz"} {
+		t.Run(fixture, func(t *testing.T) {
+			want, err := ioutil.ReadFile(filepath.Join("testdata", "http", fixture))
+			if err != nil {
+				t.Fatalf("cannot read fixture: %v", err)
+			}
+
+			r, err := decodeHTTP(&rpc.RpcHttp{
+				Method:  "POST",
+				Url:     "https://localhost/api/upload",
+				RawBody: &rpc.TypedData{Data: &rpc.TypedData_Bytes{Bytes: want}},
+				Body:    &rpc.TypedData{Data: &rpc.TypedData_String_{String_: string(want)}},
+			})
+			if err != nil {
+				t.Fatalf("failed to decode, got error: %v", err)
+			}
+
+			req := r.Interface().(http.Request)
+			got, err := ioutil.ReadAll(req.Body)
+			if err != nil {
+				t.Fatalf("cannot read body: %v", err)
+			}
+			if !bytes.Equal(got, want) {
+				t.Logf("got:  %x\nwant: %x", got, want)
+				t.Fail()
+			}
+			if got, want := req.ContentLength, int64(len(want)); got != want {
+				t.Logf("got:  %d\nwant: %d", got, want)
+				t.Fail()
+			}
+		})
+	}
+}
+
+func TestEncodeHTTP_BinaryBody(t *testing.T) {
+	png, err := ioutil.ReadFile(filepath.Join("testdata", "http", "pixel.png"))
+	if err != nil {
+		t.Fatalf("cannot read fixture: %v", err)
+	}
+	gz, err := ioutil.ReadFile(filepath.Join("testdata", "http", "payload.gz"))
+	if err != nil {
+		t.Fatalf("cannot read fixture: %v", err)
+	}
+	bytesCaps := Capabilities{RawHTTPBodyBytes: "true"}
+
+	testCases := []struct {
+		name        string
+		body        []byte
+		contentType string
+		caps        Capabilities
+		want        *rpc.TypedData
+	}{
+		{"image", png, "image/png", bytesCaps, &rpc.TypedData{Data: &rpc.TypedData_Bytes{Bytes: png}}},
+		{"gzip", gz, "application/gzip", bytesCaps, &rpc.TypedData{Data: &rpc.TypedData_Bytes{Bytes: gz}}},
+		{"binary without content type", gz, "", bytesCaps, &rpc.TypedData{Data: &rpc.TypedData_Bytes{Bytes: gz}}},
+		{"binary without host capability", png, "image/png", nil, &rpc.TypedData{Data: &rpc.TypedData_String_{String_: string(png)}}},
+		{"text", []byte("hello"), "text/plain", bytesCaps, &rpc.TypedData{Data: &rpc.TypedData_String_{String_: "hello"}}},
+		{"json", []byte(`{"a":1}`), "application/problem+json", bytesCaps, &rpc.TypedData{Data: &rpc.TypedData_String_{String_: `{"a":1}`}}},
+		{"text without content type", []byte("hello"), "", bytesCaps, &rpc.TypedData{Data: &rpc.TypedData_String_{String_: "hello"}}},
+		{"latin-1 text", []byte("caf\xe9"), "text/plain; charset=iso-8859-1", bytesCaps, &rpc.TypedData{Data: &rpc.TypedData_Bytes{Bytes: []byte("caf\xe9")}}},
+		{"shift-jis html", []byte("\x82\xa0<p>"), "text/html", bytesCaps, &rpc.TypedData{Data: &rpc.TypedData_Bytes{Bytes: []byte("\x82\xa0<p>")}}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			r := &http.Response{
+				StatusCode: http.StatusOK,
+				Header:     http.Header{},
+				Body:       ioutil.NopCloser(bytes.NewReader(tc.body)),
+			}
+			if tc.contentType != "" {
+				r.Header.Set("Content-Type", tc.contentType)
+			}
+
+			got, err := encodeHTTP(r, tc.caps)
+			if err != nil {
+				t.Fatalf("failed to encode, got error: %v", err)
+			}
+			if !proto.Equal(got.RawBody, tc.want) {
+				t.Logf("got:  %v\nwant: %v", got.RawBody, tc.want)
+				t.Fail()
+			}
+			if !proto.Equal(got.Body, tc.want) {
+				t.Logf("got:  %v\nwant: %v", got.Body, tc.want)
+				t.Fail()
+			}
+		})
+	}
+}
+
+func TestDecodeHTTP_RequestFields(t *testing.T) {
+	r, err := decodeHTTP(&rpc.RpcHttp{
+		Method: "GET",
+		Url:    "https://myapp.azurewebsites.net/api/products/42?color=red",
+		Headers: map[string]string{
+			"host":            "myapp.azurewebsites.net",
+			"accept-encoding": "gzip, deflate",
+			"x-forwarded-for": "10.0.0.1:54321, 10.0.0.2",
+			"cookie":          "session=abc; theme=dark, lang=en",
+			"user-agent":      "Mozilla/5.0 (X11; Linux x86_64)",
+		},
+		Params: map[string]string{"id": "42"},
+		Query:  map[string]string{"color": "blue", "size": "L"},
+	})
+	if err != nil {
+		t.Fatalf("failed to decode, got error: %v", err)
+	}
+	req := r.Interface().(http.Request)
+
+	if got, want := azfunc.RouteParam(&req, "id"), "42"; got != want {
+		t.Logf("got:  %q\nwant: %q", got, want)
+		t.Fail()
+	}
+	if got, want := req.URL.Query(), (url.Values{"color": {"red"}, "size": {"L"}}); !reflect.DeepEqual(got, want) {
+		t.Logf("got:  %v\nwant: %v", got, want)
+		t.Fail()
+	}
+	if got, want := req.Header["Accept-Encoding"], []string{"gzip", "deflate"}; !reflect.DeepEqual(got, want) {
+		t.Logf("got:  %q\nwant: %q", got, want)
+		t.Fail()
+	}
+	if got, want := req.UserAgent(), "Mozilla/5.0 (X11; Linux x86_64)"; got != want {
+		t.Logf("got:  %q\nwant: %q", got, want)
+		t.Fail()
+	}
+	var cookies []string
+	for _, c := range req.Cookies() {
+		cookies = append(cookies, c.String())
+	}
+	if got, want := cookies, []string{"session=abc", "theme=dark", "lang=en"}; !reflect.DeepEqual(got, want) {
+		t.Logf("got:  %q\nwant: %q", got, want)
+		t.Fail()
+	}
+	if got, want := req.Host, "myapp.azurewebsites.net"; got != want {
+		t.Logf("got:  %q\nwant: %q", got, want)
+		t.Fail()
+	}
+	if got, want := req.RemoteAddr, "10.0.0.1:54321"; got != want {
+		t.Logf("got:  %q\nwant: %q", got, want)
+		t.Fail()
+	}
+	if got, want := req.RequestURI, "/api/products/42?color=red&size=L"; got != want {
+		t.Logf("got:  %q\nwant: %q", got, want)
+		t.Fail()
+	}
+}
+
+func TestEncodeHTTP_RoundTrip(t *testing.T) {
+	cookie := "session=abc; Path=/; Expires=Wed, 21 Oct 2015 07:28:00 GMT; HttpOnly"
+	header := http.Header{
+		"Content-Type":  {"application/octet-stream"},
+		"Cache-Control": {"no-cache", "no-store"},
+		"Vary":          {"Accept", "Accept-Encoding"},
+		"Set-Cookie":    {cookie},
+		"Trailer":       {"Checksum"},
+	}
+	body := []byte{0x00, 0xff, 0x10, 0x80}
+	closed := &closeRecorder{Reader: bytes.NewReader(body)}
+
+	encoded, err := encodeHTTP(&http.Response{
+		StatusCode: http.StatusAccepted,
+		Header:     header,
+		Trailer:    http.Header{"Checksum": {"abc123"}},
+		Body:       closed,
+	}, Capabilities{RawHTTPBodyBytes: "true"})
+	if err != nil {
+		t.Fatalf("failed to encode, got error: %v", err)
+	}
+	if !closed.closed {
+		t.Errorf("expected the response body to be closed")
+	}
+	if got, want := encoded.StatusCode, "202"; got != want {
+		t.Logf("got:  %q\nwant: %q", got, want)
+		t.Fail()
+	}
+	wantHeaders := map[string]string{
+		"Content-Type":  "application/octet-stream",
+		"Cache-Control": "no-cache, no-store",
+		"Vary":          "Accept, Accept-Encoding",
+		"Set-Cookie":    cookie,
+		"Checksum":      "abc123",
+	}
+	if got := encoded.Headers; !reflect.DeepEqual(got, wantHeaders) {
+		t.Logf("got:  %q\nwant: %q", got, wantHeaders)
+		t.Fail()
+	}
+
+	r, err := decodeHTTP(&rpc.RpcHttp{
+		Method:  "POST",
+		Url:     "https://localhost/api/echo",
+		Headers: encoded.Headers,
+		RawBody: encoded.RawBody,
+	})
+	if err != nil {
+		t.Fatalf("failed to decode, got error: %v", err)
+	}
+	req := r.Interface().(http.Request)
+
+	want := http.Header{
+		"Content-Type":  {"application/octet-stream"},
+		"Cache-Control": {"no-cache", "no-store"},
+		"Vary":          {"Accept", "Accept-Encoding"},
+		"Set-Cookie":    {cookie},
+		"Checksum":      {"abc123"},
+	}
+	if got := req.Header; !reflect.DeepEqual(got, want) {
+		t.Logf("got:  %q\nwant: %q", got, want)
+		t.Fail()
+	}
+	got, err := ioutil.ReadAll(req.Body)
+	if err != nil {
+		t.Fatalf("cannot read body: %v", err)
+	}
+	if !bytes.Equal(got, body) {
+		t.Logf("got:  %x\nwant: %x", got, body)
+		t.Fail()
+	}
+}
+
+func TestEncodeHTTP_Cookies(t *testing.T) {
+	testCases := []struct {
+		name    string
+		cookies []string
+		want    string
+		wantErr bool
+	}{
+		{"no cookie", nil, "", false},
+		{"one cookie", []string{"theme=dark"}, "theme=dark", false},
+		{"several cookies", []string{"theme=dark", "lang=en; Max-Age=3600"}, "", true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			header := http.Header{}
+			for _, c := range tc.cookies {
+				header.Add("Set-Cookie", c)
+			}
+
+			encoded, err := encodeHTTP(&http.Response{Header: header}, Capabilities{})
+			if tc.wantErr {
+				if err == nil {
+					t.Errorf("expected an error, got headers: %q", encoded.Headers)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("failed to encode, got error: %v", err)
+			}
+			if got, want := encoded.Headers["Set-Cookie"], tc.want; got != want {
+				t.Logf("got:  %q\nwant: %q", got, want)
+				t.Fail()
+			}
+		})
+	}
+}
+
+func TestEncodeHTTP_Defaults(t *testing.T) {
+	testCases := []struct {
+		name        string
+		resp        *http.Response
+		wantBody    *rpc.TypedData
+		negotiation bool
+	}{
+		{
+			"nil body and zero status",
+			&http.Response{},
+			&rpc.TypedData{Data: &rpc.TypedData_String_{String_: ""}},
+			false,
+		},
+		{
+			"JSON without content type",
+			&http.Response{Body: ioutil.NopCloser(bytes.NewBufferString(`{"name":"gopher"}`))},
+			&rpc.TypedData{Data: &rpc.TypedData_Json{Json: `{"name":"gopher"}`}},
+			true,
+		},
+		{
+			"JSON with content type",
+			&http.Response{
+				Header: http.Header{"Content-Type": {"application/json"}},
+				Body:   ioutil.NopCloser(bytes.NewBufferString(`{"name":"gopher"}`)),
+			},
+			&rpc.TypedData{Data: &rpc.TypedData_String_{String_: `{"name":"gopher"}`}},
+			false,
+		},
+		{
+			"text without content type",
+			&http.Response{Body: ioutil.NopCloser(bytes.NewBufferString("42"))},
+			&rpc.TypedData{Data: &rpc.TypedData_String_{String_: "42"}},
+			false,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := encodeHTTP(tc.resp, nil)
+			if err != nil {
+				t.Fatalf("failed to encode, got error: %v", err)
+			}
+			if got, want := got.StatusCode, "200"; got != want {
+				t.Logf("got:  %q\nwant: %q", got, want)
+				t.Fail()
+			}
+			if !proto.Equal(got.Body, tc.wantBody) {
+				t.Logf("got:  %v\nwant: %v", got.Body, tc.wantBody)
+				t.Fail()
+			}
+			if got.EnableContentNegotiation != tc.negotiation {
+				t.Logf("got:  %t\nwant: %t", got.EnableContentNegotiation, tc.negotiation)
+				t.Fail()
+			}
+		})
+	}
+}
+
+// closeRecorder records whether the body was closed
+type closeRecorder struct {
+	io.Reader
+	closed bool
+}
+
+func (c *closeRecorder) Close() error {
+	c.closed = true
+	return nil
+}
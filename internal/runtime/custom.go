@@ -0,0 +1,144 @@
+package runtime
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+
+	"github.com/vladbarosan/func-go/azfunc"
+	"github.com/vladbarosan/func-go/internal/rpc"
+)
+
+var (
+	bindingUnmarshalerType = reflect.TypeOf((*azfunc.BindingUnmarshaler)(nil)).Elem()
+	bindingMarshalerType   = reflect.TypeOf((*azfunc.BindingMarshaler)(nil)).Elem()
+)
+
+// decodeCustom decodes data with the converter registered for pt or with its BindingUnmarshaler implementation.
+// It returns false if neither exists and the built-in conversions apply.
+func decodeCustom(pt reflect.Type, data *rpc.TypedData, tm map[string]*rpc.TypedData) (reflect.Value, bool, error) {
+	t := pt
+	if pt.Kind() == reflect.Ptr {
+		t = pt.Elem()
+	}
+
+	for _, ct := range []reflect.Type{pt, t} {
+		c, ok := azfunc.ConverterFor(ct)
+		if !ok || c.Unmarshal == nil {
+			continue
+		}
+
+		i, err := c.Unmarshal(rawData(data), rawMetadata(tm))
+		if err != nil {
+			return reflect.Value{}, true, fmt.Errorf("converter for %v failed: %v", ct, err)
+		}
+		v := reflect.ValueOf(i)
+		if !v.IsValid() || !v.Type().AssignableTo(ct) {
+			return reflect.Value{}, true, fmt.Errorf("converter for %v returned %T", ct, i)
+		}
+		if ct == pt {
+			return v, true, nil
+		}
+		pv := reflect.New(t)
+		pv.Elem().Set(v)
+		return pv, true, nil
+	}
+
+	if !reflect.PtrTo(t).Implements(bindingUnmarshalerType) {
+		return reflect.Value{}, false, nil
+	}
+
+	pv := reflect.New(t)
+	if err := pv.Interface().(azfunc.BindingUnmarshaler).UnmarshalBinding(rawData(data), rawMetadata(tm)); err != nil {
+		return reflect.Value{}, true, fmt.Errorf("cannot unmarshal binding into %v: %v", t, err)
+	}
+	if pt.Kind() == reflect.Ptr {
+		return pv, true, nil
+	}
+	return pv.Elem(), true, nil
+}
+
+// encodeCustom encodes v with the converter registered for its type or with its BindingMarshaler implementation.
+// It returns false if neither exists and the built-in conversions apply.
+func encodeCustom(v reflect.Value) (*rpc.TypedData, bool, error) {
+	if c, ok := azfunc.ConverterFor(v.Type()); ok && c.Marshal != nil {
+		r, err := c.Marshal(v.Interface())
+		if err != nil {
+			return nil, true, fmt.Errorf("converter for %v failed: %v", v.Type(), err)
+		}
+		d, err := typedData(r)
+		return d, true, err
+	}
+
+	if v.Kind() == reflect.Interface || !v.Type().Implements(bindingMarshalerType) || (v.Kind() == reflect.Ptr && v.IsNil()) {
+		return nil, false, nil
+	}
+
+	r, err := v.Interface().(azfunc.BindingMarshaler).MarshalBinding()
+	if err != nil {
+		return nil, true, fmt.Errorf("cannot marshal binding from %v: %v", v.Type(), err)
+	}
+	d, err := typedData(r)
+	return d, true, err
+}
+
+// rawData returns the undecoded content of a protobuf value
+func rawData(d *rpc.TypedData) azfunc.RawData {
+	switch d.GetData().(type) {
+	case *rpc.TypedData_Json:
+		return azfunc.RawData{Kind: azfunc.DataJSON, Value: []byte(d.GetJson())}
+	case *rpc.TypedData_Bytes:
+		return azfunc.RawData{Kind: azfunc.DataBytes, Value: d.GetBytes()}
+	case *rpc.TypedData_Stream:
+		return azfunc.RawData{Kind: azfunc.DataStream, Value: d.GetStream()}
+	case *rpc.TypedData_Int:
+		return azfunc.RawData{Kind: azfunc.DataInt, Value: []byte(strconv.FormatInt(d.GetInt(), 10))}
+	case *rpc.TypedData_Double:
+		return azfunc.RawData{Kind: azfunc.DataDouble, Value: []byte(strconv.FormatFloat(d.GetDouble(), 'g', -1, 64))}
+	case *rpc.TypedData_Http:
+		body := d.GetHttp().GetRawBody()
+		if body.GetData() == nil {
+			body = d.GetHttp().GetBody()
+		}
+		return azfunc.RawData{Kind: azfunc.DataHTTP, Value: rawData(body).Value}
+	default:
+		return azfunc.RawData{Kind: azfunc.DataString, Value: []byte(d.GetString_())}
+	}
+}
+
+// rawMetadata returns the undecoded content of the trigger metadata
+func rawMetadata(tm map[string]*rpc.TypedData) map[string]azfunc.RawData {
+	m := make(map[string]azfunc.RawData, len(tm))
+	for k, d := range tm {
+		m[k] = rawData(d)
+	}
+	return m
+}
+
+// typedData returns the protobuf value of data returned by a converter
+func typedData(r azfunc.RawData) (*rpc.TypedData, error) {
+	switch r.Kind {
+	case azfunc.DataString:
+		return &rpc.TypedData{Data: &rpc.TypedData_String_{String_: string(r.Value)}}, nil
+	case azfunc.DataJSON:
+		return &rpc.TypedData{Data: &rpc.TypedData_Json{Json: string(r.Value)}}, nil
+	case azfunc.DataBytes:
+		return &rpc.TypedData{Data: &rpc.TypedData_Bytes{Bytes: r.Value}}, nil
+	case azfunc.DataStream:
+		return &rpc.TypedData{Data: &rpc.TypedData_Stream{Stream: r.Value}}, nil
+	case azfunc.DataInt:
+		i, err := strconv.ParseInt(string(r.Value), 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		return &rpc.TypedData{Data: &rpc.TypedData_Int{Int: i}}, nil
+	case azfunc.DataDouble:
+		f, err := strconv.ParseFloat(string(r.Value), 64)
+		if err != nil {
+			return nil, err
+		}
+		return &rpc.TypedData{Data: &rpc.TypedData_Double{Double: f}}, nil
+	default:
+		return nil, fmt.Errorf("cannot send %v data as an output binding", r.Kind)
+	}
+}
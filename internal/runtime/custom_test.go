@@ -0,0 +1,168 @@
+package runtime
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/vladbarosan/func-go/azfunc"
+	"github.com/vladbarosan/func-go/internal/rpc"
+)
+
+// order decodes itself from the data and the trigger metadata
+type order struct {
+	ID    string
+	Items []string
+}
+
+func (o *order) UnmarshalBinding(data azfunc.RawData, metadata map[string]azfunc.RawData) error {
+	if data.Kind != azfunc.DataString {
+		return fmt.Errorf("unexpected %v data", data.Kind)
+	}
+	o.ID = string(metadata["Id"].Value)
+	o.Items = strings.Split(string(data.Value), ",")
+	return nil
+}
+
+func (o order) MarshalBinding() (azfunc.RawData, error) {
+	return azfunc.RawData{Kind: azfunc.DataString, Value: []byte(o.ID + ":" + strings.Join(o.Items, ","))}, nil
+}
+
+// celsius stands for a type from another package, converted by a registered converter
+type celsius float64
+
+func init() {
+	azfunc.RegisterConverter(celsius(0), azfunc.Converter{
+		Unmarshal: func(data azfunc.RawData, metadata map[string]azfunc.RawData) (interface{}, error) {
+			f, err := strconv.ParseFloat(strings.TrimSuffix(string(data.Value), "C"), 64)
+			return celsius(f), err
+		},
+		Marshal: func(v interface{}) (azfunc.RawData, error) {
+			return azfunc.RawData{Kind: azfunc.DataString, Value: []byte(fmt.Sprintf("%gC", float64(v.(celsius))))}, nil
+		},
+	})
+}
+
+func TestConvertToTypeValue_Custom(t *testing.T) {
+	data := &rpc.TypedData{Data: &rpc.TypedData_String_{String_: "a,b"}}
+	tm := map[string]*rpc.TypedData{
+		"Id": {Data: &rpc.TypedData_String_{String_: "42"}},
+	}
+	c := celsius(21.5)
+
+	testCases := []struct {
+		name string
+		data *rpc.TypedData
+		typ  reflect.Type
+		want interface{}
+	}{
+		{"BindingUnmarshaler", data, reflect.TypeOf(order{}), order{ID: "42", Items: []string{"a", "b"}}},
+		{"BindingUnmarshaler pointer", data, reflect.TypeOf(&order{}), &order{ID: "42", Items: []string{"a", "b"}}},
+		{"registered converter", &rpc.TypedData{Data: &rpc.TypedData_String_{String_: "21.5C"}}, reflect.TypeOf(c), c},
+		{"registered converter pointer", &rpc.TypedData{Data: &rpc.TypedData_String_{String_: "21.5C"}}, reflect.TypeOf(&c), &c},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			v, err := convertToTypeValue(tc.typ, tc.data, tm)
+			if err != nil {
+				t.Fatalf("failed to convert, got error: %v", err)
+			}
+			if got, want := v.Interface(), tc.want; !reflect.DeepEqual(got, want) {
+				t.Logf("got:  %v\nwant: %v", got, want)
+				t.Fail()
+			}
+		})
+	}
+}
+
+func TestConvertToTypeValue_CustomError(t *testing.T) {
+	data := &rpc.TypedData{Data: &rpc.TypedData_Json{Json: `["a","b"]`}}
+	if v, err := convertToTypeValue(reflect.TypeOf(order{}), data, nil); err == nil {
+		t.Errorf("expected the error of the unmarshaler, got value: %v", v)
+	}
+}
+
+func TestEncodeProto_Custom(t *testing.T) {
+	c := celsius(-3)
+	testCases := []struct {
+		name  string
+		value interface{}
+		want  *rpc.TypedData
+	}{
+		{"BindingMarshaler", order{ID: "1", Items: []string{"a"}}, &rpc.TypedData{Data: &rpc.TypedData_String_{String_: "1:a"}}},
+		{"BindingMarshaler pointer", &order{ID: "1", Items: []string{"a"}}, &rpc.TypedData{Data: &rpc.TypedData_String_{String_: "1:a"}}},
+		{"registered converter", c, &rpc.TypedData{Data: &rpc.TypedData_String_{String_: "-3C"}}},
+		{"registered converter pointer", &c, &rpc.TypedData{Data: &rpc.TypedData_String_{String_: "-3C"}}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := encodeProto(reflect.ValueOf(tc.value), nil)
+			if err != nil {
+				t.Fatalf("failed to encode, got error: %v", err)
+			}
+			if !proto.Equal(got, tc.want) {
+				t.Logf("got:  %v\nwant: %v", got, tc.want)
+				t.Fail()
+			}
+		})
+	}
+}
+
+// brokenOrder panics when it is decoded or encoded
+type brokenOrder struct {
+	items map[string]int
+}
+
+func (o *brokenOrder) UnmarshalBinding(data azfunc.RawData, metadata map[string]azfunc.RawData) error {
+	o.items[string(data.Value)] = 1
+	return nil
+}
+
+func (o brokenOrder) MarshalBinding() (azfunc.RawData, error) {
+	panic("cannot marshal order")
+}
+
+func TestExecuteFunc_CustomPanics(t *testing.T) {
+	testCases := []struct {
+		name    string
+		handler interface{}
+		want    string
+	}{
+		{
+			"unmarshaler",
+			func(azfunc.Context, brokenOrder) (string, error) { return "", nil },
+			"input conversion panicked: assignment to entry in nil map",
+		},
+		{
+			"marshaler",
+			func(azfunc.Context, string) (brokenOrder, error) { return brokenOrder{}, nil },
+			"output conversion panicked: cannot marshal order",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			r := NewRegistry()
+			r.setFunc("queue", queueFunction(tc.handler))
+
+			resp := r.ExecuteFunc(context.Background(), queueInvocation(), &recordingSender{})
+			if got, want := resp.Result.Status, rpc.StatusResult_Failure; got != want {
+				t.Fatalf("got:  %v\nwant: %v", got, want)
+			}
+			e := resp.Result.Exception
+			if e == nil || e.Message != tc.want {
+				t.Logf("got:  %v\nwant: %q", e, tc.want)
+				t.Fail()
+			}
+			if e == nil || !strings.Contains(e.StackTrace, "custom_test.go") {
+				t.Errorf("expected the panicking converter in the stack trace, got: %v", e)
+			}
+		})
+	}
+}
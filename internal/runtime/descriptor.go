@@ -0,0 +1,99 @@
+package runtime
+
+import (
+	"reflect"
+
+	"github.com/vladbarosan/func-go/azfunc"
+	"github.com/vladbarosan/func-go/internal/rpc"
+)
+
+// returnBinding is the name of the binding receiving the return value of a function
+const returnBinding = "$return"
+
+// functionDescriptor returns the azfunc.Function exported by a plugin as its entry point
+func functionDescriptor(symbol interface{}) (*azfunc.Function, bool) {
+	switch d := symbol.(type) {
+	case *azfunc.Function:
+		return d, d != nil
+	case **azfunc.Function:
+		return *d, d != nil && *d != nil
+	default:
+		return nil, false
+	}
+}
+
+// describedFunc returns the function of an azfunc.Function entry point.
+// Its parameters are bound by the names of the descriptor instead of the names in the source.
+func describedFunc(metadata *rpc.RpcFunctionMetadata, d *azfunc.Function) (*function, error) {
+	v := reflect.ValueOf(d.Handler)
+	if v.Kind() != reflect.Func || v.IsNil() {
+		return nil, loadErrorf(EntryPointNotFound, "handler of entrypoint %s is not func, but %T", metadata.EntryPoint, d.Handler)
+	}
+	t := v.Type()
+
+	if len(d.In) != t.NumIn() {
+		return nil, loadErrorf(BindingMismatch, "entrypoint %s names %d parameters, handler has %d", metadata.EntryPoint, len(d.In), t.NumIn())
+	}
+	if len(d.Out) != t.NumOut() {
+		return nil, loadErrorf(BindingMismatch, "entrypoint %s names %d results, handler has %d", metadata.EntryPoint, len(d.Out), t.NumOut())
+	}
+
+	// every parameter needs a field to get its value from, the context is bound by its type
+	in := make([]string, len(d.In))
+	for i, name := range d.In {
+		switch {
+		case name != "":
+			in[i] = name
+		case isContextType(t.In(i)):
+			in[i] = contextParam
+		case isBindingStruct(t.In(i)):
+			// the fields of input structs name their bindings
+		default:
+			return nil, loadErrorf(BindingMismatch, "parameter %d of entrypoint %s has no binding name", i, metadata.EntryPoint)
+		}
+	}
+
+	ins, err := describedFields(in, metadata.GetBindings(), t.In)
+	if err != nil {
+		return nil, err
+	}
+	outs, err := describedFields(d.Out, metadata.GetBindings(), t.Out)
+	if err != nil {
+		return nil, err
+	}
+	ins = structFields(ins, metadata.GetBindings(), t.In, t.NumIn())
+	outs = structFields(outs, metadata.GetBindings(), t.Out, t.NumOut())
+	if err := checkBindings(metadata, t, ins, outs); err != nil {
+		return nil, err
+	}
+
+	return &function{
+		handler:   v,
+		signature: t,
+		declared:  true,
+		in:        ins,
+		out:       outs,
+		metadata:  metadata,
+	}, nil
+}
+
+// describedFields returns the fields for the binding names of a descriptor,
+// results that are unnamed or named $return take a position without being a field
+func describedFields(names []string, bindings map[string]*rpc.BindingInfo, fi iterator) (map[string]*funcField, error) {
+	fields := map[string]*funcField{}
+	for i, name := range names {
+		if name == "" || name == returnBinding {
+			continue
+		}
+		if _, ok := fields[name]; ok {
+			return nil, loadErrorf(BindingMismatch, "binding %s is named more than once", name)
+		}
+		fields[name] = &funcField{
+			Name:     name,
+			Type:     fi(i),
+			Position: i,
+			Binding:  bindings[name],
+		}
+	}
+	return fields, nil
+}
@@ -0,0 +1,131 @@
+package runtime
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/vladbarosan/func-go/azfunc"
+	"github.com/vladbarosan/func-go/internal/rpc"
+)
+
+type greeter struct {
+	greeting string
+}
+
+func (g *greeter) Greet(ctx azfunc.Context, name string) (string, error) {
+	return g.greeting + " " + name, nil
+}
+
+func TestFunctionDescriptor(t *testing.T) {
+	d := &azfunc.Function{Handler: func() {}}
+	var nilDescriptor *azfunc.Function
+
+	testCases := []struct {
+		name   string
+		symbol interface{}
+		want   bool
+	}{
+		{"descriptor variable", d, true},
+		{"descriptor pointer variable", &d, true},
+		{"nil descriptor pointer variable", &nilDescriptor, false},
+		{"func", func() {}, false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, got := functionDescriptor(tc.symbol); got != tc.want {
+				t.Logf("got:  %t\nwant: %t", got, tc.want)
+				t.Fail()
+			}
+		})
+	}
+}
+
+func TestExecuteFunc_Descriptor(t *testing.T) {
+	for _, output := range []string{"msg", "$return"} {
+		t.Run(output, func(t *testing.T) {
+			metadata := &rpc.RpcFunctionMetadata{
+				Name:       "Greet",
+				EntryPoint: "Run",
+				Bindings: map[string]*rpc.BindingInfo{
+					"who":  {Type: "queueTrigger", Direction: rpc.BindingInfo_in},
+					output: {Type: "queue", Direction: rpc.BindingInfo_out},
+				},
+			}
+			f, err := describedFunc(metadata, &azfunc.Function{
+				Handler: (&greeter{greeting: "hello"}).Greet,
+				In:      []string{"", "who"},
+				Out:     []string{output, ""},
+			})
+			if err != nil {
+				t.Fatalf("failed to load descriptor, got error: %v", err)
+			}
+			if f.fromSource() {
+				t.Fatal("expected the bindings to come from the descriptor")
+			}
+
+			r := NewRegistry()
+			r.setFunc("greet", f)
+			resp := r.ExecuteFunc(context.Background(), &rpc.InvocationRequest{
+				InvocationId: "1",
+				FunctionId:   "greet",
+				InputData: []*rpc.ParameterBinding{{
+					Name: "who",
+					Data: &rpc.TypedData{Data: &rpc.TypedData_String_{String_: "gopher"}},
+				}},
+			}, &recordingSender{})
+
+			if got, want := resp.Result.Status, rpc.StatusResult_Success; got != want {
+				t.Fatalf("got:  %v\nwant: %v", got, want)
+			}
+			got := resp.ReturnValue.GetJson()
+			if output != "$return" {
+				if len(resp.OutputData) != 1 || resp.OutputData[0].Name != output {
+					t.Fatalf("expected the %s output, got: %v", output, resp.OutputData)
+				}
+				got = resp.OutputData[0].Data.GetJson()
+			}
+			if want := `"hello gopher"`; got != want {
+				t.Logf("got:  %q\nwant: %q", got, want)
+				t.Fail()
+			}
+		})
+	}
+}
+
+func TestDescribedFunc_Errors(t *testing.T) {
+	metadata := &rpc.RpcFunctionMetadata{
+		EntryPoint: "Run",
+		Bindings: map[string]*rpc.BindingInfo{
+			"who": {Type: "queueTrigger", Direction: rpc.BindingInfo_in},
+		},
+	}
+	handler := func(ctx azfunc.Context, name string) error { return nil }
+
+	testCases := []struct {
+		name       string
+		descriptor *azfunc.Function
+		want       string
+	}{
+		{"not a func", &azfunc.Function{Handler: "Run"}, "is not func"},
+		{"missing parameter name", &azfunc.Function{Handler: handler, In: []string{"who"}, Out: []string{""}}, "names 1 parameters, handler has 2"},
+		{"missing result name", &azfunc.Function{Handler: handler, In: []string{"", "who"}}, "names 0 results, handler has 1"},
+		{"unnamed parameter", &azfunc.Function{Handler: handler, In: []string{"", ""}, Out: []string{""}}, "parameter 1 of entrypoint Run has no binding name"},
+		{"unknown binding", &azfunc.Function{Handler: handler, In: []string{"", "whom"}, Out: []string{""}}, "no binding in function.json for parameters: whom"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := describedFunc(metadata, tc.descriptor)
+			le, ok := err.(*LoadError)
+			if !ok {
+				t.Fatalf("expected a *LoadError, got: %v", err)
+			}
+			if got := le.Error(); !strings.Contains(got, tc.want) {
+				t.Logf("got:  %q\nwant: %q", got, tc.want)
+				t.Fail()
+			}
+		})
+	}
+}
@@ -0,0 +1,178 @@
+package runtime
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+
+	logrus "github.com/Sirupsen/logrus"
+	"github.com/vladbarosan/func-go/azfunc"
+	"github.com/vladbarosan/func-go/internal/rpc"
+)
+
+// LoadErrorKind categorizes why a function could not be loaded
+type LoadErrorKind int
+
+// LoadErrorKind values
+const (
+	// PluginOpenError means the compiled plugin of the function could not be opened
+	PluginOpenError LoadErrorKind = iota
+	// EntryPointNotFound means the entry point is missing from the plugin or from the source
+	EntryPointNotFound
+	// SourceParseError means the source file of the function could not be parsed
+	SourceParseError
+	// BindingMismatch means the entry point parameters do not match the function bindings
+	BindingMismatch
+	// InvalidMiddleware means the plugin exports a Middleware symbol that is not []azfunc.Middleware
+	InvalidMiddleware
+)
+
+func (k LoadErrorKind) String() string {
+	switch k {
+	case PluginOpenError:
+		return "plugin open error"
+	case EntryPointNotFound:
+		return "entry point not found"
+	case SourceParseError:
+		return "source parse error"
+	case BindingMismatch:
+		return "parameter and binding mismatch"
+	case InvalidMiddleware:
+		return "invalid middleware"
+	default:
+		return fmt.Sprintf("LoadErrorKind(%d)", int(k))
+	}
+}
+
+// LoadError is returned when a function cannot be loaded
+type LoadError struct {
+	Kind LoadErrorKind
+	Err  error
+}
+
+func (e *LoadError) Error() string {
+	return fmt.Sprintf("%s: %v", e.Kind, e.Err)
+}
+
+// loadErrorf returns a *LoadError of the given kind with a formatted message
+func loadErrorf(kind LoadErrorKind, format string, args ...interface{}) *LoadError {
+	return &LoadError{
+		Kind: kind,
+		Err:  fmt.Errorf(format, args...),
+	}
+}
+
+// reportError completes the response of an invocation that returned an *azfunc.Error.
+// Functions with an http output binding respond with the status and body of the error,
+// other functions fail with the stack trace of the error in their exception.
+func reportError(ir *rpc.InvocationResponse, fe *azfunc.Error, metadata *rpc.RpcFunctionMetadata, fctx *funcContext) {
+	exception := &rpc.RpcException{
+		Message:    fe.Error(),
+		Source:     "User function",
+		StackTrace: fe.StackTrace,
+	}
+	properties := errorProperties{
+		Retryable: fe.Retryable,
+	}
+
+	_, output := httpBindings(metadata)
+	if output == "" {
+		ir.Result.Exception = exception
+		fctx.logException(exception, rpc.RpcLog_Error, properties.String())
+		return
+	}
+
+	status := fe.StatusCode
+	if status == 0 {
+		status = http.StatusInternalServerError
+	}
+	properties.StatusCode = status
+
+	resp, err := errorResponse(fe, status, fctx.host.Capabilities)
+	if err != nil {
+		logrus.Debugf("cannot encode http response of error: %v", err)
+		ir.Result.Exception = exception
+		fctx.logException(exception, rpc.RpcLog_Error, properties.String())
+		return
+	}
+
+	// the error is the response of the function, the invocation itself succeeded
+	ir.Result = &rpc.StatusResult{
+		Status: rpc.StatusResult_Success,
+	}
+	if output == returnBinding {
+		ir.ReturnValue = resp
+	} else {
+		ir.OutputData = setOutput(ir.OutputData, output, resp)
+	}
+
+	level := rpc.RpcLog_Warning
+	if status >= http.StatusInternalServerError {
+		level = rpc.RpcLog_Error
+	}
+	fctx.logException(exception, level, properties.String())
+}
+
+// errorProperties are the details of an *azfunc.Error sent with its exception log
+type errorProperties struct {
+	Retryable  bool `json:"retryable"`
+	StatusCode int  `json:"statusCode,omitempty"`
+}
+
+func (p errorProperties) String() string {
+	b, err := json.Marshal(p)
+	if err != nil {
+		return ""
+	}
+	return string(b)
+}
+
+// errorResponse returns the HTTP response of an *azfunc.Error
+func errorResponse(fe *azfunc.Error, status int, caps Capabilities) (*rpc.TypedData, error) {
+	var body []byte
+	var contentType string
+	switch b := fe.Body.(type) {
+	case nil:
+		body, contentType = []byte(fe.Error()), "text/plain; charset=utf-8"
+	case string:
+		body, contentType = []byte(b), "text/plain; charset=utf-8"
+	case []byte:
+		body, contentType = b, http.DetectContentType(b)
+	default:
+		j, err := json.Marshal(b)
+		if err != nil {
+			return nil, err
+		}
+		body, contentType = j, "application/json"
+	}
+
+	h, err := encodeHTTP(&http.Response{
+		StatusCode: status,
+		Header:     http.Header{"Content-Type": {contentType}},
+		Body:       ioutil.NopCloser(bytes.NewReader(body)),
+	}, caps)
+	if err != nil {
+		return nil, err
+	}
+	return &rpc.TypedData{
+		Data: &rpc.TypedData_Http{
+			Http: h,
+		},
+	}, nil
+}
+
+// setOutput returns the output bindings with the data of the named one replaced or added
+func setOutput(outputs []*rpc.ParameterBinding, name string, d *rpc.TypedData) []*rpc.ParameterBinding {
+	for _, o := range outputs {
+		if o != nil && o.Name == name {
+			o.Data = d
+			return outputs
+		}
+	}
+	return append(outputs, &rpc.ParameterBinding{
+		Name: name,
+		Data: d,
+	})
+}
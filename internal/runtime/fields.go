@@ -0,0 +1,139 @@
+package runtime
+
+import (
+	"reflect"
+	"sort"
+
+	"github.com/vladbarosan/func-go/internal/rpc"
+)
+
+// bindingTag is the struct tag naming the binding of a field of an input or output struct
+const bindingTag = "azfunc"
+
+// bindingStruct returns the struct type of t, or of the pointer t, if it has exported fields tagged with a binding name
+func bindingStruct(t reflect.Type) (reflect.Type, bool) {
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		return nil, false
+	}
+	for i := 0; i < t.NumField(); i++ {
+		if bindingName(t.Field(i)) != "" {
+			return t, true
+		}
+	}
+	return nil, false
+}
+
+// isBindingStruct returns true if t is an input or output struct, or a pointer to one
+func isBindingStruct(t reflect.Type) bool {
+	_, ok := bindingStruct(t)
+	return ok
+}
+
+// bindingName returns the binding of a struct field from its azfunc tag, or "" if it is not bound
+func bindingName(sf reflect.StructField) string {
+	name := sf.Tag.Get(bindingTag)
+	if name == "-" || sf.PkgPath != "" {
+		return ""
+	}
+	return name
+}
+
+// structFields replaces the params or results of a function that are input or output structs with their tagged fields,
+// which are bound by the name in their tag instead of the name of the param
+func structFields(fields map[string]*funcField, bindings map[string]*rpc.BindingInfo, fi iterator, l int) map[string]*funcField {
+	for i := 0; i < l; i++ {
+		st, ok := bindingStruct(fi(i))
+		if !ok {
+			continue
+		}
+		for name, f := range fields {
+			if f.Position == i {
+				delete(fields, name)
+			}
+		}
+		for j := 0; j < st.NumField(); j++ {
+			sf := st.Field(j)
+			name := bindingName(sf)
+			if name == "" {
+				continue
+			}
+			fields[name] = &funcField{
+				Name:     name,
+				Type:     sf.Type,
+				Position: i,
+				Field:    sf.Index,
+				Binding:  bindings[name],
+			}
+		}
+	}
+	return fields
+}
+
+// newParams returns the params of an invocation of a function of type t,
+// with a new value for the input structs so their fields can be set
+func newParams(t reflect.Type) []reflect.Value {
+	params := make([]reflect.Value, t.NumIn())
+	for i := range params {
+		pt := t.In(i)
+		if !isBindingStruct(pt) {
+			continue
+		}
+		if pt.Kind() == reflect.Ptr {
+			params[i] = reflect.New(pt.Elem())
+		} else {
+			params[i] = reflect.New(pt).Elem()
+		}
+	}
+	return params
+}
+
+// setParam sets the value of the param bound to f, or of its field in an input struct
+func setParam(params []reflect.Value, f *funcField, v reflect.Value) {
+	if f.Field == nil {
+		params[f.Position] = v
+		return
+	}
+	// inputs missing from the invocation leave the zero value in the struct
+	if v.IsValid() {
+		reflect.Indirect(params[f.Position]).FieldByIndex(f.Field).Set(v)
+	}
+}
+
+// resultValue returns the value of the result bound to f, or of its field in an output struct
+func resultValue(values []reflect.Value, f *funcField) reflect.Value {
+	v := values[f.Position]
+	if f.Field == nil {
+		return v
+	}
+	if v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return reflect.Zero(f.Type)
+		}
+		v = v.Elem()
+	}
+	return v.FieldByIndex(f.Field)
+}
+
+// sortedFields returns the fields in the order of the params, then of the fields of input and output structs
+func sortedFields(fields map[string]*funcField) []*funcField {
+	sorted := make([]*funcField, 0, len(fields))
+	for _, f := range fields {
+		sorted = append(sorted, f)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		a, b := sorted[i], sorted[j]
+		if a.Position != b.Position {
+			return a.Position < b.Position
+		}
+		for k := 0; k < len(a.Field) && k < len(b.Field); k++ {
+			if a.Field[k] != b.Field[k] {
+				return a.Field[k] < b.Field[k]
+			}
+		}
+		return len(a.Field) < len(b.Field)
+	})
+	return sorted
+}
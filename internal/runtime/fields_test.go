@@ -0,0 +1,171 @@
+package runtime
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/vladbarosan/func-go/azfunc"
+	"github.com/vladbarosan/func-go/internal/rpc"
+)
+
+type queueInputs struct {
+	Msg     string            `azfunc:"msg"`
+	Meta    map[string]string `azfunc:"meta"`
+	Ignored string
+	Skipped string `azfunc:"-"`
+}
+
+type queueOutputs struct {
+	Copy  string `azfunc:"copy"`
+	Count int    `azfunc:"count"`
+}
+
+const queueSource = `package main
+
+func Run(ctx azfunc.Context, in *queueInputs) (queueOutputs, error) {
+	return queueOutputs{}, nil
+}
+`
+
+func queueStructsMetadata(t *testing.T) *rpc.RpcFunctionMetadata {
+	dir, err := ioutil.TempDir("", "fields")
+	if err != nil {
+		t.Fatalf("cannot create source directory: %v", err)
+	}
+	src := filepath.Join(dir, "main.go")
+	if err := ioutil.WriteFile(src, []byte(queueSource), 0644); err != nil {
+		t.Fatalf("cannot write source: %v", err)
+	}
+
+	return &rpc.RpcFunctionMetadata{
+		Name:       "Queue",
+		EntryPoint: "Run",
+		ScriptFile: src,
+		Bindings: map[string]*rpc.BindingInfo{
+			"msg":   {Type: "queueTrigger", Direction: rpc.BindingInfo_in},
+			"meta":  {Type: "blob", Direction: rpc.BindingInfo_in},
+			"copy":  {Type: "queue", Direction: rpc.BindingInfo_out},
+			"count": {Type: "queue", Direction: rpc.BindingInfo_out},
+		},
+	}
+}
+
+func TestLoadInOut_Structs(t *testing.T) {
+	metadata := queueStructsMetadata(t)
+	defer os.RemoveAll(filepath.Dir(metadata.ScriptFile))
+
+	handler := func(ctx azfunc.Context, in *queueInputs) (queueOutputs, error) { return queueOutputs{}, nil }
+	ins, outs, err := loadInOut(metadata, reflect.TypeOf(handler))
+	if err != nil {
+		t.Fatalf("failed to load params, got error: %v", err)
+	}
+
+	want := map[string]*funcField{
+		"ctx":  {Name: "ctx", Type: reflect.TypeOf(handler).In(0), Position: 0},
+		"msg":  {Name: "msg", Type: reflect.TypeOf(""), Position: 1, Field: []int{0}, Binding: metadata.Bindings["msg"]},
+		"meta": {Name: "meta", Type: reflect.TypeOf(map[string]string{}), Position: 1, Field: []int{1}, Binding: metadata.Bindings["meta"]},
+	}
+	if !reflect.DeepEqual(ins, want) {
+		t.Logf("got:  %v\nwant: %v", ins, want)
+		t.Fail()
+	}
+
+	want = map[string]*funcField{
+		"copy":  {Name: "copy", Type: reflect.TypeOf(""), Position: 0, Field: []int{0}, Binding: metadata.Bindings["copy"]},
+		"count": {Name: "count", Type: reflect.TypeOf(0), Position: 0, Field: []int{1}, Binding: metadata.Bindings["count"]},
+	}
+	if !reflect.DeepEqual(outs, want) {
+		t.Logf("got:  %v\nwant: %v", outs, want)
+		t.Fail()
+	}
+}
+
+func TestExecuteFunc_Structs(t *testing.T) {
+	metadata := queueStructsMetadata(t)
+	defer os.RemoveAll(filepath.Dir(metadata.ScriptFile))
+
+	var got *queueInputs
+	handler := func(ctx azfunc.Context, in *queueInputs) (queueOutputs, error) {
+		got = in
+		return queueOutputs{Copy: in.Msg + " copy", Count: 2}, nil
+	}
+	ins, outs, err := loadInOut(metadata, reflect.TypeOf(handler))
+	if err != nil {
+		t.Fatalf("failed to load params, got error: %v", err)
+	}
+
+	r := NewRegistry()
+	r.setFunc("queue", &function{
+		handler:   reflect.ValueOf(handler),
+		signature: reflect.TypeOf(handler),
+		in:        ins,
+		out:       outs,
+		metadata:  metadata,
+	})
+	resp := r.ExecuteFunc(context.Background(), &rpc.InvocationRequest{
+		InvocationId: "1",
+		FunctionId:   "queue",
+		InputData: []*rpc.ParameterBinding{{
+			Name: "msg",
+			Data: &rpc.TypedData{Data: &rpc.TypedData_String_{String_: "hello"}},
+		}},
+	}, &recordingSender{})
+
+	if status := resp.Result.Status; status != rpc.StatusResult_Success {
+		t.Fatalf("got:  %v\nwant: %v", status, rpc.StatusResult_Success)
+	}
+	if want := (&queueInputs{Msg: "hello"}); !reflect.DeepEqual(got, want) {
+		t.Logf("got:  %+v\nwant: %+v", got, want)
+		t.Fail()
+	}
+
+	want := []*rpc.ParameterBinding{
+		{Name: "copy", Data: &rpc.TypedData{Data: &rpc.TypedData_Json{Json: `"hello copy"`}}},
+		{Name: "count", Data: &rpc.TypedData{Data: &rpc.TypedData_Int{Int: 2}}},
+	}
+	if !reflect.DeepEqual(resp.OutputData, want) {
+		t.Logf("got:  %v\nwant: %v", resp.OutputData, want)
+		t.Fail()
+	}
+	if resp.ReturnValue != nil {
+		t.Logf("got:  %v\nwant: no return value", resp.ReturnValue)
+		t.Fail()
+	}
+}
+
+func TestDescribedFunc_Structs(t *testing.T) {
+	metadata := &rpc.RpcFunctionMetadata{
+		EntryPoint: "Run",
+		Bindings: map[string]*rpc.BindingInfo{
+			"msg":   {Type: "queueTrigger", Direction: rpc.BindingInfo_in},
+			"meta":  {Type: "blob", Direction: rpc.BindingInfo_in},
+			"copy":  {Type: "queue", Direction: rpc.BindingInfo_out},
+			"count": {Type: "queue", Direction: rpc.BindingInfo_out},
+		},
+	}
+	f, err := describedFunc(metadata, &azfunc.Function{
+		Handler: func(ctx azfunc.Context, in queueInputs) (*queueOutputs, error) { return nil, nil },
+		In:      []string{"", ""},
+		Out:     []string{"", ""},
+	})
+	if err != nil {
+		t.Fatalf("failed to load descriptor, got error: %v", err)
+	}
+
+	for _, name := range []string{"msg", "meta"} {
+		if got, ok := f.in[name]; !ok || got.Position != 1 {
+			t.Logf("got:  %v\nwant: field of parameter 1", got)
+			t.Fail()
+		}
+	}
+	for _, name := range []string{"copy", "count"} {
+		if got, ok := f.out[name]; !ok || got.Position != 0 {
+			t.Logf("got:  %v\nwant: field of result 0", got)
+			t.Fail()
+		}
+	}
+}
@@ -1,8 +1,11 @@
 package runtime
 
 import (
+	"fmt"
 	"reflect"
+	"runtime/debug"
 
+	"github.com/vladbarosan/func-go/azfunc"
 	"github.com/vladbarosan/func-go/internal/rpc"
 )
 
@@ -12,6 +15,20 @@ type function struct {
 	signature reflect.Type
 	in        map[string]*funcField
 	out       map[string]*funcField
+	metadata  *rpc.RpcFunctionMetadata
+	// httpHandler is true if the entry point is an http.Handler adapted by the worker,
+	// its in and out params come from function.json instead of the source
+	httpHandler bool
+	// middleware is exported by the plugin of the function and applies to its invocations
+	middleware []azfunc.Middleware
+	// declared is true if the entry point is an azfunc.Function naming the bindings of its params,
+	// the source is not parsed for them
+	declared bool
+}
+
+// fromSource returns true if the names of the in and out params are parsed from the source of the function
+func (f *function) fromSource() bool {
+	return !f.httpHandler && !f.declared
 }
 
 // funcField represents a representation of a func field
@@ -20,10 +37,47 @@ type funcField struct {
 	Type     reflect.Type
 	Binding  *rpc.BindingInfo
 	Position int
+	// Field is the index of the field bound in an input or output struct, nil if the whole param is bound
+	Field []int
+}
+
+// panicError is returned when user code panics, with the stack of the panicking goroutine
+type panicError struct {
+	// in is the user code that panicked, the function or a binding conversion
+	in    string
+	value interface{}
+	stack []byte
+}
+
+func (e *panicError) Error() string {
+	return fmt.Sprintf("%s panicked: %v", e.in, e.value)
 }
 
-//Call executes the binded function and returns the output
-func (f *function) Invoke(params []reflect.Value) ([]reflect.Value, error) {
-	output := f.handler.Call(params)
-	return output, nil
+//Call executes the binded function and returns the output.
+//A panic in the function goes up through the middleware of the invocation, which can recover it.
+func (f *function) Invoke(params []reflect.Value) []reflect.Value {
+	return f.handler.Call(params)
+}
+
+// invoke runs an invocation through its middleware,
+// a panic in the function or in the middleware that no middleware recovers is returned as a *panicError
+func invoke(h azfunc.Handler, inv *azfunc.Invocation) error {
+	return protect("function", func() error {
+		return h(inv)
+	})
+}
+
+// protect runs fn, which calls the user code in, and returns a panic in it as a *panicError
+func protect(in string, fn func() error) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = &panicError{
+				in:    in,
+				value: r,
+				stack: debug.Stack(),
+			}
+		}
+	}()
+
+	return fn()
 }
@@ -0,0 +1,183 @@
+package runtime
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/vladbarosan/func-go/azfunc"
+	"github.com/vladbarosan/func-go/internal/rpc"
+)
+
+func TestExecuteFunc_RecoversPanic(t *testing.T) {
+	r := NewRegistry()
+	r.setFunc("panicking", &function{
+		handler: reflect.ValueOf(func() string {
+			var m map[string]string
+			m["key"] = "value"
+			return ""
+		}),
+		in:       map[string]*funcField{},
+		out:      map[string]*funcField{},
+		metadata: &rpc.RpcFunctionMetadata{Name: "Panicking"},
+	})
+	r.setFunc("healthy", &function{
+		handler:  reflect.ValueOf(func() string { return "ok" }),
+		in:       map[string]*funcField{},
+		out:      map[string]*funcField{},
+		metadata: &rpc.RpcFunctionMetadata{Name: "Healthy"},
+	})
+
+	s := &recordingSender{}
+	resp := r.ExecuteFunc(context.Background(), &rpc.InvocationRequest{InvocationId: "1", FunctionId: "panicking"}, s)
+
+	if got, want := resp.Result.Status, rpc.StatusResult_Failure; got != want {
+		t.Fatalf("got:  %v\nwant: %v", got, want)
+	}
+	e := resp.Result.Exception
+	if e == nil || !strings.Contains(e.Message, "assignment to entry in nil map") {
+		t.Errorf("expected the panic message in the exception, got: %v", e)
+	}
+	if e == nil || !strings.Contains(e.StackTrace, "func_test.go") {
+		t.Errorf("expected the panicking function in the stack trace, got: %v", e)
+	}
+
+	logs := s.sent()
+	if len(logs) != 1 || logs[0].GetRpcLog().GetLevel() != rpc.RpcLog_Error || logs[0].GetRpcLog().GetException() == nil {
+		t.Errorf("expected an error log with the exception, got: %v", logs)
+	}
+
+	resp = r.ExecuteFunc(context.Background(), &rpc.InvocationRequest{InvocationId: "2", FunctionId: "healthy"}, s)
+	if got, want := resp.Result.Status, rpc.StatusResult_Success; got != want {
+		t.Logf("got:  %v\nwant: %v", got, want)
+		t.Fail()
+	}
+}
+
+// recordingSender keeps every message sent by a function
+type recordingSender struct {
+	mu       sync.Mutex
+	messages []*rpc.StreamingMessage
+}
+
+func (s *recordingSender) Send(msg *rpc.StreamingMessage) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.messages = append(s.messages, msg)
+	return nil
+}
+
+func (s *recordingSender) sent() []*rpc.StreamingMessage {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]*rpc.StreamingMessage(nil), s.messages...)
+}
+
+func TestExecuteFunc_AzfuncError(t *testing.T) {
+	notFound := func() (*http.Response, error) {
+		return nil, &azfunc.Error{
+			Err:        errors.New("no such user"),
+			StatusCode: http.StatusNotFound,
+			Body:       map[string]string{"error": "no such user"},
+			StackTrace: "main.Run()",
+		}
+	}
+
+	testCases := []struct {
+		name     string
+		bindings map[string]*rpc.BindingInfo
+		handler  interface{}
+		out      map[string]*funcField
+	}{
+		{
+			"return value",
+			map[string]*rpc.BindingInfo{"$return": {Type: "http", Direction: rpc.BindingInfo_out}},
+			func() (*http.Response, error) { return notFound() },
+			map[string]*funcField{},
+		},
+		{
+			"output binding",
+			map[string]*rpc.BindingInfo{"res": {Type: "http", Direction: rpc.BindingInfo_out}},
+			func() (res *http.Response, err error) { return notFound() },
+			map[string]*funcField{"res": {Name: "res", Type: reflect.TypeOf(&http.Response{}), Position: 0}},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			r := NewRegistry()
+			r.setFunc("http", &function{
+				handler:  reflect.ValueOf(tc.handler),
+				in:       map[string]*funcField{},
+				out:      tc.out,
+				metadata: &rpc.RpcFunctionMetadata{Name: "Http", Bindings: tc.bindings},
+			})
+
+			s := &recordingSender{}
+			resp := r.ExecuteFunc(context.Background(), &rpc.InvocationRequest{InvocationId: "1", FunctionId: "http"}, s)
+
+			if got, want := resp.Result.Status, rpc.StatusResult_Success; got != want {
+				t.Fatalf("got:  %v\nwant: %v", got, want)
+			}
+			d := resp.ReturnValue
+			if len(tc.out) > 0 {
+				d = resp.OutputData[0].Data
+			}
+			if got, want := d.GetHttp().GetStatusCode(), "404"; got != want {
+				t.Logf("got:  %q\nwant: %q", got, want)
+				t.Fail()
+			}
+			if got, want := d.GetHttp().GetBody().GetString_(), `{"error":"no such user"}`; got != want {
+				t.Logf("got:  %q\nwant: %q", got, want)
+				t.Fail()
+			}
+
+			logs := s.sent()
+			if len(logs) != 1 || logs[0].GetRpcLog().GetLevel() != rpc.RpcLog_Warning {
+				t.Fatalf("expected a warning log, got: %v", logs)
+			}
+			if got, want := logs[0].GetRpcLog().GetProperties(), `{"retryable":false,"statusCode":404}`; got != want {
+				t.Logf("got:  %q\nwant: %q", got, want)
+				t.Fail()
+			}
+		})
+	}
+}
+
+func TestExecuteFunc_AzfuncErrorWithoutHTTP(t *testing.T) {
+	r := NewRegistry()
+	r.setFunc("queue", &function{
+		handler: reflect.ValueOf(func() error {
+			return azfunc.RetryableError(errors.New("storage is busy"))
+		}),
+		in:  map[string]*funcField{},
+		out: map[string]*funcField{},
+		metadata: &rpc.RpcFunctionMetadata{Name: "Queue", Bindings: map[string]*rpc.BindingInfo{
+			"msg": {Type: "queueTrigger", Direction: rpc.BindingInfo_in},
+		}},
+	})
+
+	s := &recordingSender{}
+	resp := r.ExecuteFunc(context.Background(), &rpc.InvocationRequest{InvocationId: "1", FunctionId: "queue"}, s)
+
+	if got, want := resp.Result.Status, rpc.StatusResult_Failure; got != want {
+		t.Fatalf("got:  %v\nwant: %v", got, want)
+	}
+	e := resp.Result.Exception
+	if e == nil || e.Message != "storage is busy" || !strings.Contains(e.StackTrace, "func_test.go") {
+		t.Errorf("expected the message and stack trace of the error, got: %v", e)
+	}
+
+	logs := s.sent()
+	if len(logs) != 1 || logs[0].GetRpcLog().GetLevel() != rpc.RpcLog_Error {
+		t.Fatalf("expected an error log, got: %v", logs)
+	}
+	if got, want := logs[0].GetRpcLog().GetProperties(), `{"retryable":true}`; got != want {
+		t.Logf("got:  %q\nwant: %q", got, want)
+		t.Fail()
+	}
+}
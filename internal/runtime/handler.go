@@ -0,0 +1,169 @@
+package runtime
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"reflect"
+	"strconv"
+
+	"github.com/vladbarosan/func-go/azfunc"
+	"github.com/vladbarosan/func-go/internal/rpc"
+)
+
+// contextParam is the name of the azfunc.Context parameter of the functions that do not name it,
+// like those adapting an http.Handler
+const contextParam = "$context"
+
+// httpHandler returns the http.Handler of an entry point that is a func(http.ResponseWriter, *http.Request)
+// or a variable holding an http.Handler, like a *http.ServeMux or a router of another package
+func httpHandler(symbol interface{}) (http.Handler, bool) {
+	if h, ok := symbol.(http.Handler); ok {
+		return h, true
+	}
+	if f, ok := symbol.(func(http.ResponseWriter, *http.Request)); ok {
+		return http.HandlerFunc(f), true
+	}
+
+	// plugins return pointers to variables
+	v := reflect.ValueOf(symbol)
+	if v.Kind() != reflect.Ptr || v.IsNil() {
+		return nil, false
+	}
+	switch e := v.Elem().Interface().(type) {
+	case http.Handler:
+		return e, e != nil && !isNil(reflect.ValueOf(e))
+	case func(http.ResponseWriter, *http.Request):
+		return http.HandlerFunc(e), e != nil
+	default:
+		return nil, false
+	}
+}
+
+// isNil returns true if v holds a nil pointer, func, map, slice, chan or interface
+func isNil(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Func, reflect.Map, reflect.Slice, reflect.Chan, reflect.Interface:
+		return v.IsNil()
+	default:
+		return false
+	}
+}
+
+// handlerFunc returns a function serving the HTTP trigger of metadata with h.
+// Its parameters come from the http bindings in function.json since there is no signature to read them from,
+// and like other entry points it fails to load if function.json has bindings it cannot serve.
+func handlerFunc(metadata *rpc.RpcFunctionMetadata, h http.Handler) (*function, error) {
+	trigger, output := httpBindings(metadata)
+	if trigger == "" {
+		return nil, loadErrorf(BindingMismatch, "http handler %s needs an httpTrigger binding in function.json", metadata.EntryPoint)
+	}
+	if output == "" {
+		return nil, loadErrorf(BindingMismatch, "http handler %s needs an http output binding in function.json", metadata.EntryPoint)
+	}
+
+	serve := func(ctx azfunc.Context, req *http.Request) *http.Response {
+		// handlers see the cancellation of the invocation through the request context
+		req = req.WithContext(azfunc.WithRouteParams(ctx, azfunc.RouteParams(req)))
+
+		w := newResponseRecorder()
+		h.ServeHTTP(w, req)
+		return w.result(req)
+	}
+	t := reflect.TypeOf(serve)
+
+	f := &function{
+		handler:     reflect.ValueOf(serve),
+		signature:   t,
+		httpHandler: true,
+		metadata:    metadata,
+		in: map[string]*funcField{
+			contextParam: {Name: contextParam, Type: t.In(0), Position: 0},
+			trigger:      {Name: trigger, Type: t.In(1), Position: 1, Binding: metadata.Bindings[trigger]},
+		},
+		out: map[string]*funcField{},
+	}
+	// without a named output binding the response is the return value
+	if output != returnBinding {
+		f.out[output] = &funcField{Name: output, Type: t.Out(0), Position: 0, Binding: metadata.Bindings[output]}
+	}
+
+	// the other bindings have no parameter to reach the handler
+	if err := checkBindings(metadata, t, f.in, f.out); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// httpBindings returns the names of the httpTrigger and http output bindings of a function, or "" if it has none
+func httpBindings(metadata *rpc.RpcFunctionMetadata) (trigger, output string) {
+	for name, b := range metadata.GetBindings() {
+		switch {
+		case b.Type == "httpTrigger" && b.Direction == rpc.BindingInfo_in:
+			trigger = name
+		case b.Type == "http" && b.Direction == rpc.BindingInfo_out:
+			output = name
+		}
+	}
+	return trigger, output
+}
+
+// responseRecorder is the http.ResponseWriter given to http.Handler entry points
+type responseRecorder struct {
+	header      http.Header
+	body        bytes.Buffer
+	status      int
+	wroteHeader bool
+}
+
+func newResponseRecorder() *responseRecorder {
+	return &responseRecorder{
+		header: http.Header{},
+	}
+}
+
+func (w *responseRecorder) Header() http.Header {
+	return w.header
+}
+
+func (w *responseRecorder) Write(b []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	return w.body.Write(b)
+}
+
+func (w *responseRecorder) WriteHeader(status int) {
+	if w.wroteHeader {
+		return
+	}
+	w.wroteHeader = true
+	w.status = status
+}
+
+// Flush is a no-op, the response is sent to the host once the handler returns
+func (w *responseRecorder) Flush() {}
+
+// result returns the recorded response
+func (w *responseRecorder) result(req *http.Request) *http.Response {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	// like net/http, the content type is sniffed from the body when the handler did not set it
+	if _, ok := w.header["Content-Type"]; !ok && w.body.Len() > 0 {
+		w.header.Set("Content-Type", http.DetectContentType(w.body.Bytes()))
+	}
+
+	body := w.body.Bytes()
+	return &http.Response{
+		Status:        strconv.Itoa(w.status) + " " + http.StatusText(w.status),
+		StatusCode:    w.status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        w.header,
+		Body:          ioutil.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}
+}
@@ -0,0 +1,125 @@
+package runtime
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/vladbarosan/func-go/azfunc"
+	"github.com/vladbarosan/func-go/internal/rpc"
+)
+
+func TestHTTPHandler(t *testing.T) {
+	handlerFunc := func(w http.ResponseWriter, r *http.Request) {}
+	var mux http.Handler = http.NewServeMux()
+	var nilHandler http.Handler
+	var nilMux *http.ServeMux
+
+	testCases := []struct {
+		name   string
+		symbol interface{}
+		want   bool
+	}{
+		{"func", handlerFunc, true},
+		{"func variable", &handlerFunc, true},
+		{"handler", http.NewServeMux(), true},
+		{"handler variable", &mux, true},
+		{"concrete handler variable", &nilMux, false},
+		{"nil handler variable", &nilHandler, false},
+		{"other func", func(ctx azfunc.Context) {}, false},
+		{"other variable", new(string), false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, got := httpHandler(tc.symbol); got != tc.want {
+				t.Logf("got:  %t\nwant: %t", got, tc.want)
+				t.Fail()
+			}
+		})
+	}
+}
+
+func TestExecuteFunc_HTTPHandler(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/hello", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Custom", "a")
+		w.Header().Add("Custom", "b")
+		w.WriteHeader(http.StatusCreated)
+		fmt.Fprintf(w, "hello %s from %s", r.URL.Query().Get("name"), azfunc.RouteParam(r, "id"))
+	})
+
+	for _, output := range []string{"$return", "res"} {
+		t.Run(output, func(t *testing.T) {
+			metadata := &rpc.RpcFunctionMetadata{
+				Name:       "Handler",
+				EntryPoint: "Handler",
+				Bindings: map[string]*rpc.BindingInfo{
+					"req":  {Type: "httpTrigger", Direction: rpc.BindingInfo_in},
+					output: {Type: "http", Direction: rpc.BindingInfo_out},
+				},
+			}
+			f, err := handlerFunc(metadata, mux)
+			if err != nil {
+				t.Fatalf("failed to adapt handler, got error: %v", err)
+			}
+			r := NewRegistry()
+			r.setFunc("handler", f)
+
+			resp := r.ExecuteFunc(context.Background(), &rpc.InvocationRequest{
+				InvocationId: "1",
+				FunctionId:   "handler",
+				InputData: []*rpc.ParameterBinding{{
+					Name: "req",
+					Data: &rpc.TypedData{Data: &rpc.TypedData_Http{Http: &rpc.RpcHttp{
+						Method: "GET",
+						Url:    "https://localhost/api/hello?name=gopher",
+						Params: map[string]string{"id": "42"},
+					}}},
+				}},
+			}, &recordingSender{})
+
+			if got, want := resp.Result.Status, rpc.StatusResult_Success; got != want {
+				t.Fatalf("got:  %v\nwant: %v", got, want)
+			}
+			d := resp.ReturnValue
+			if output != "$return" {
+				if len(resp.OutputData) != 1 || resp.OutputData[0].Name != output {
+					t.Fatalf("expected the response in output %s, got: %v", output, resp.OutputData)
+				}
+				d = resp.OutputData[0].Data
+			}
+
+			h := d.GetHttp()
+			if got, want := h.GetStatusCode(), "201"; got != want {
+				t.Logf("got:  %q\nwant: %q", got, want)
+				t.Fail()
+			}
+			if got, want := h.GetBody().GetString_(), "hello gopher from 42"; got != want {
+				t.Logf("got:  %q\nwant: %q", got, want)
+				t.Fail()
+			}
+			if got, want := h.GetHeaders()["Content-Type"], "text/plain; charset=utf-8"; got != want {
+				t.Logf("got:  %q\nwant: %q", got, want)
+				t.Fail()
+			}
+			if h.GetHeaders()["Custom"] == "" {
+				t.Errorf("expected the headers set by the handler, got: %v", h.GetHeaders())
+			}
+		})
+	}
+}
+
+func TestHandlerFunc_NoTrigger(t *testing.T) {
+	_, err := handlerFunc(&rpc.RpcFunctionMetadata{
+		EntryPoint: "Handler",
+		Bindings: map[string]*rpc.BindingInfo{
+			"msg": {Type: "queueTrigger", Direction: rpc.BindingInfo_in},
+		},
+	}, http.NewServeMux())
+
+	if le, ok := err.(*LoadError); !ok || le.Kind != BindingMismatch {
+		t.Errorf("expected a %v error, got: %v", BindingMismatch, err)
+	}
+}
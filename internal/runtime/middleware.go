@@ -0,0 +1,149 @@
+package runtime
+
+import (
+	"fmt"
+	"plugin"
+	"reflect"
+
+	"github.com/vladbarosan/func-go/azfunc"
+)
+
+// middlewareSymbol is the name of the variable of a plugin holding the middleware of its functions
+const middlewareSymbol = "Middleware"
+
+// Use adds middleware to the invocations of every function, the first added is the outermost
+func (r *Registry) Use(m ...azfunc.Middleware) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	old := r.middleware.Load().([]azfunc.Middleware)
+	mw := make([]azfunc.Middleware, 0, len(old)+len(m))
+	r.middleware.Store(append(append(mw, old...), m...))
+}
+
+// pluginMiddleware returns the middleware exported by a plugin, if any
+func pluginMiddleware(p *plugin.Plugin) ([]azfunc.Middleware, error) {
+	symbol, err := p.Lookup(middlewareSymbol)
+	if err != nil {
+		return nil, nil
+	}
+	mw, ok := symbol.(*[]azfunc.Middleware)
+	if !ok {
+		return nil, loadErrorf(InvalidMiddleware, "symbol %s is not []azfunc.Middleware, but %T", middlewareSymbol, symbol)
+	}
+	return *mw, nil
+}
+
+// chain wraps h with the middleware of the registry, then with the middleware of f
+func (r *Registry) chain(f *function, h azfunc.Handler) (azfunc.Handler, bool) {
+	global := r.middleware.Load().([]azfunc.Middleware)
+	mw := append(append([]azfunc.Middleware{}, global...), f.middleware...)
+	for i := len(mw) - 1; i >= 0; i-- {
+		h = mw[i](h)
+	}
+	return h, len(mw) > 0
+}
+
+// setInputs replaces the args of an invocation with the inputs left by the middleware
+func setInputs(args map[string]reflect.Value, fields map[string]*funcField, inputs map[string]interface{}) error {
+	for name, i := range inputs {
+		f, ok := fields[name]
+		if !ok {
+			return fmt.Errorf("middleware set input %s that is not in the function bindings", name)
+		}
+		v := reflect.ValueOf(i)
+		if !v.IsValid() {
+			v = reflect.Zero(f.Type)
+		}
+		if !v.Type().AssignableTo(f.Type) {
+			return fmt.Errorf("middleware set input %s to %T, the function takes %v", name, i, f.Type)
+		}
+		args[name] = v
+	}
+	return nil
+}
+
+// invocationOutputs returns the outputs of an invocation by binding name
+func invocationOutputs(values []reflect.Value, t reflect.Type, fields map[string]*funcField) map[string]interface{} {
+	outputs := map[string]interface{}{}
+	for _, f := range fields {
+		outputs[f.Name] = resultValue(values, f).Interface()
+	}
+	if i, ok := returnPosition(t, fields); ok {
+		outputs[returnBinding] = values[i].Interface()
+	}
+	return outputs
+}
+
+// setOutputs replaces the results of an invocation of a function of type t with the outputs left by the middleware
+func setOutputs(values []reflect.Value, t reflect.Type, fields map[string]*funcField, outputs map[string]interface{}) error {
+	for name, o := range outputs {
+		f, ok := fields[name]
+		pos, field, ft := 0, []int(nil), reflect.Type(nil)
+		switch {
+		case ok:
+			pos, field, ft = f.Position, f.Field, f.Type
+		case name == returnBinding:
+			if pos, ok = returnPosition(t, fields); !ok {
+				return fmt.Errorf("middleware set output %s but the function has no return value", name)
+			}
+			ft = t.Out(pos)
+		default:
+			return fmt.Errorf("middleware set output %s that is not in the function bindings", name)
+		}
+
+		v := reflect.ValueOf(o)
+		if !v.IsValid() {
+			v = reflect.Zero(ft)
+		}
+		if !v.Type().AssignableTo(ft) {
+			return fmt.Errorf("middleware set output %s to %T, the function returns %v", name, o, ft)
+		}
+		setResult(values, t.Out(pos), pos, field, v)
+	}
+	return nil
+}
+
+// setResult sets the result at pos, or its field in an output struct, to v
+func setResult(values []reflect.Value, rt reflect.Type, pos int, field []int, v reflect.Value) {
+	if field == nil {
+		values[pos] = v
+		return
+	}
+
+	// results are not addressable, the output struct is copied to set its field
+	var s reflect.Value
+	if rt.Kind() == reflect.Ptr {
+		s = reflect.New(rt.Elem())
+		if !values[pos].IsNil() {
+			s.Elem().Set(values[pos].Elem())
+		}
+	} else {
+		s = reflect.New(rt).Elem()
+		s.Set(values[pos])
+	}
+	reflect.Indirect(s).FieldByIndex(field).Set(v)
+	values[pos] = s
+}
+
+// returnPosition returns the position of the result of a function of type t sent as the return value, like ToProto does
+func returnPosition(t reflect.Type, fields map[string]*funcField) (int, bool) {
+	if len(fields) > 0 {
+		return 0, false
+	}
+	for i := 0; i < t.NumOut(); i++ {
+		if t.Out(i) != errorType {
+			return i, true
+		}
+	}
+	return 0, false
+}
+
+// zeroResults returns the zero value of every result of a function of type t, for invocations the function did not complete
+func zeroResults(t reflect.Type) []reflect.Value {
+	values := make([]reflect.Value, t.NumOut())
+	for i := range values {
+		values[i] = reflect.Zero(t.Out(i))
+	}
+	return values
+}
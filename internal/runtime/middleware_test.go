@@ -0,0 +1,278 @@
+package runtime
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/vladbarosan/func-go/azfunc"
+	"github.com/vladbarosan/func-go/internal/rpc"
+)
+
+// recordMiddleware returns middleware appending its name to calls before and after the invocation
+func recordMiddleware(name string, calls *[]string) azfunc.Middleware {
+	return func(next azfunc.Handler) azfunc.Handler {
+		return func(inv *azfunc.Invocation) error {
+			*calls = append(*calls, name+" before")
+			err := next(inv)
+			*calls = append(*calls, name+" after")
+			return err
+		}
+	}
+}
+
+func queueFunction(handler interface{}, middleware ...azfunc.Middleware) *function {
+	t := reflect.TypeOf(handler)
+	return &function{
+		handler:   reflect.ValueOf(handler),
+		signature: t,
+		in: map[string]*funcField{
+			"ctx": {Name: "ctx", Type: t.In(0), Position: 0},
+			"msg": {Name: "msg", Type: t.In(1), Position: 1, Binding: &rpc.BindingInfo{Type: "queueTrigger"}},
+		},
+		out: map[string]*funcField{
+			"copy": {Name: "copy", Type: t.Out(0), Position: 0, Binding: &rpc.BindingInfo{Type: "queue", Direction: rpc.BindingInfo_out}},
+		},
+		metadata:   &rpc.RpcFunctionMetadata{Name: "Queue"},
+		middleware: middleware,
+	}
+}
+
+func queueInvocation() *rpc.InvocationRequest {
+	return &rpc.InvocationRequest{
+		InvocationId: "1",
+		FunctionId:   "queue",
+		InputData: []*rpc.ParameterBinding{{
+			Name: "msg",
+			Data: &rpc.TypedData{Data: &rpc.TypedData_String_{String_: "hello"}},
+		}},
+	}
+}
+
+func TestExecuteFunc_MiddlewareOrder(t *testing.T) {
+	var calls []string
+	r := NewRegistry()
+	r.Use(recordMiddleware("worker 1", &calls), recordMiddleware("worker 2", &calls))
+	r.setFunc("queue", queueFunction(func(ctx azfunc.Context, msg string) (string, error) {
+		calls = append(calls, "function")
+		return msg, nil
+	}, recordMiddleware("plugin", &calls)))
+
+	resp := r.ExecuteFunc(context.Background(), queueInvocation(), &recordingSender{})
+	if got, want := resp.Result.Status, rpc.StatusResult_Success; got != want {
+		t.Fatalf("got:  %v\nwant: %v", got, want)
+	}
+
+	want := []string{"worker 1 before", "worker 2 before", "plugin before", "function", "plugin after", "worker 2 after", "worker 1 after"}
+	if !reflect.DeepEqual(calls, want) {
+		t.Logf("got:  %q\nwant: %q", calls, want)
+		t.Fail()
+	}
+}
+
+func TestExecuteFunc_MiddlewareInvocation(t *testing.T) {
+	type tenantContext struct {
+		azfunc.Context
+	}
+
+	var seen interface{}
+	r := NewRegistry()
+	r.Use(func(next azfunc.Handler) azfunc.Handler {
+		return func(inv *azfunc.Invocation) error {
+			inv.Context = tenantContext{inv.Context}
+			inv.Inputs["msg"] = strings.ToUpper(inv.Inputs["msg"].(string))
+			err := next(inv)
+			seen = inv.Outputs["copy"]
+			inv.Outputs["copy"] = inv.Outputs["copy"].(string) + " (audited)"
+			return err
+		}
+	})
+
+	var gotCtx azfunc.Context
+	r.setFunc("queue", queueFunction(func(ctx azfunc.Context, msg string) (string, error) {
+		gotCtx = ctx
+		return msg + " copy", nil
+	}))
+
+	resp := r.ExecuteFunc(context.Background(), queueInvocation(), &recordingSender{})
+	if got, want := resp.Result.Status, rpc.StatusResult_Success; got != want {
+		t.Fatalf("got:  %v\nwant: %v", got, want)
+	}
+	if _, ok := gotCtx.(tenantContext); !ok {
+		t.Errorf("expected the context set by the middleware, got: %T", gotCtx)
+	}
+	if got, want := seen, "HELLO copy"; got != want {
+		t.Logf("got:  %v\nwant: %v", got, want)
+		t.Fail()
+	}
+	if len(resp.OutputData) != 1 {
+		t.Fatalf("expected the copy output, got: %v", resp.OutputData)
+	}
+	if got, want := resp.OutputData[0].Data.GetJson(), `"HELLO copy (audited)"`; got != want {
+		t.Logf("got:  %q\nwant: %q", got, want)
+		t.Fail()
+	}
+}
+
+func TestExecuteFunc_MiddlewareErrors(t *testing.T) {
+	testCases := []struct {
+		name       string
+		middleware azfunc.Middleware
+		handler    func(azfunc.Context, string) (string, error)
+		wantStatus rpc.StatusResult_Status
+		wantMsg    string
+		wantOutput string
+	}{
+		{
+			name: "error from middleware",
+			middleware: func(next azfunc.Handler) azfunc.Handler {
+				return func(inv *azfunc.Invocation) error {
+					return errors.New("unauthorized")
+				}
+			},
+			handler:    func(azfunc.Context, string) (string, error) { return "", nil },
+			wantStatus: rpc.StatusResult_Failure,
+			wantMsg:    "unauthorized",
+		},
+		{
+			name: "error swallowed by middleware",
+			middleware: func(next azfunc.Handler) azfunc.Handler {
+				return func(inv *azfunc.Invocation) error {
+					next(inv)
+					return nil
+				}
+			},
+			handler:    func(azfunc.Context, string) (string, error) { return "", errors.New("failed") },
+			wantStatus: rpc.StatusResult_Success,
+		},
+		{
+			name: "panic recovered by middleware",
+			middleware: func(next azfunc.Handler) azfunc.Handler {
+				return func(inv *azfunc.Invocation) (err error) {
+					defer func() {
+						if r := recover(); r != nil {
+							err = fmt.Errorf("recovered: %v", r)
+						}
+					}()
+					return next(inv)
+				}
+			},
+			handler:    func(azfunc.Context, string) (string, error) { panic("boom") },
+			wantStatus: rpc.StatusResult_Failure,
+			wantMsg:    "recovered: boom",
+		},
+		{
+			name: "panic answered by middleware",
+			middleware: func(next azfunc.Handler) azfunc.Handler {
+				return func(inv *azfunc.Invocation) (err error) {
+					defer func() {
+						if r := recover(); r != nil {
+							inv.Outputs = map[string]interface{}{"copy": "fallback"}
+							err = nil
+						}
+					}()
+					return next(inv)
+				}
+			},
+			handler:    func(azfunc.Context, string) (string, error) { panic("boom") },
+			wantStatus: rpc.StatusResult_Success,
+			wantOutput: `"fallback"`,
+		},
+		{
+			name:       "panic without recovering middleware",
+			middleware: recordMiddleware("record", &[]string{}),
+			handler:    func(azfunc.Context, string) (string, error) { panic("boom") },
+			wantStatus: rpc.StatusResult_Failure,
+			wantMsg:    "function panicked: boom",
+		},
+		{
+			name: "wrong input type",
+			middleware: func(next azfunc.Handler) azfunc.Handler {
+				return func(inv *azfunc.Invocation) error {
+					inv.Inputs["msg"] = 42
+					return next(inv)
+				}
+			},
+			handler:    func(azfunc.Context, string) (string, error) { return "", nil },
+			wantStatus: rpc.StatusResult_Failure,
+			wantMsg:    "middleware set input msg to int",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			r := NewRegistry()
+			r.setFunc("queue", queueFunction(tc.handler, tc.middleware))
+
+			resp := r.ExecuteFunc(context.Background(), queueInvocation(), &recordingSender{})
+			if got := resp.Result.Status; got != tc.wantStatus {
+				t.Fatalf("got:  %v\nwant: %v", got, tc.wantStatus)
+			}
+			if tc.wantOutput != "" {
+				if len(resp.OutputData) != 1 || resp.OutputData[0].Data.GetJson() != tc.wantOutput {
+					t.Logf("got:  %v\nwant: %s", resp.OutputData, tc.wantOutput)
+					t.Fail()
+				}
+			}
+			if tc.wantMsg == "" {
+				return
+			}
+			if e := resp.Result.Exception; e == nil || !strings.Contains(e.Message, tc.wantMsg) {
+				t.Logf("got:  %v\nwant to contain: %q", e, tc.wantMsg)
+				t.Fail()
+			}
+		})
+	}
+}
+
+func TestExecuteFunc_MiddlewareHTTPResponse(t *testing.T) {
+	r := NewRegistry()
+	r.Use(func(next azfunc.Handler) azfunc.Handler {
+		return func(inv *azfunc.Invocation) error {
+			if inv.Inputs["req"].(*http.Request).Header.Get("Authorization") == "" {
+				inv.Outputs = map[string]interface{}{
+					"$return": &http.Response{StatusCode: http.StatusUnauthorized},
+				}
+				return nil
+			}
+			return next(inv)
+		}
+	})
+
+	handler := func(ctx azfunc.Context, req *http.Request) *http.Response {
+		t.Error("expected the middleware to answer the request")
+		return nil
+	}
+	ht := reflect.TypeOf(handler)
+	r.setFunc("http", &function{
+		handler:   reflect.ValueOf(handler),
+		signature: ht,
+		in: map[string]*funcField{
+			"ctx": {Name: "ctx", Type: ht.In(0), Position: 0},
+			"req": {Name: "req", Type: ht.In(1), Position: 1, Binding: &rpc.BindingInfo{Type: "httpTrigger"}},
+		},
+		out:      map[string]*funcField{},
+		metadata: &rpc.RpcFunctionMetadata{Name: "Http"},
+	})
+
+	resp := r.ExecuteFunc(context.Background(), &rpc.InvocationRequest{
+		InvocationId: "1",
+		FunctionId:   "http",
+		InputData: []*rpc.ParameterBinding{{
+			Name: "req",
+			Data: &rpc.TypedData{Data: &rpc.TypedData_Http{Http: &rpc.RpcHttp{Method: "GET", Url: "https://localhost/api"}}},
+		}},
+	}, &recordingSender{})
+
+	if got, want := resp.Result.Status, rpc.StatusResult_Success; got != want {
+		t.Fatalf("got:  %v\nwant: %v", got, want)
+	}
+	if got, want := resp.ReturnValue.GetHttp().GetStatusCode(), "401"; got != want {
+		t.Logf("got:  %q\nwant: %q", got, want)
+		t.Fail()
+	}
+}
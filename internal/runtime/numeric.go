@@ -0,0 +1,112 @@
+package runtime
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+
+	"github.com/vladbarosan/func-go/internal/rpc"
+)
+
+// decodeInt returns a value of type t from a protobuf integer, failing if it does not fit into t
+func decodeInt(i int64, t reflect.Type) (reflect.Value, error) {
+	v := reflect.New(t).Elem()
+
+	switch t.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if v.OverflowInt(i) {
+			return reflect.Value{}, fmt.Errorf("%d overflows %v", i, t)
+		}
+		v.SetInt(i)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		if i < 0 || v.OverflowUint(uint64(i)) {
+			return reflect.Value{}, fmt.Errorf("%d overflows %v", i, t)
+		}
+		v.SetUint(uint64(i))
+	case reflect.Float32, reflect.Float64:
+		v.SetFloat(float64(i))
+	case reflect.String:
+		v.SetString(strconv.FormatInt(i, 10))
+	case reflect.Interface:
+		if !reflect.TypeOf(i).Implements(t) {
+			return reflect.Value{}, fmt.Errorf("int64 does not implement %v", t)
+		}
+		v.Set(reflect.ValueOf(i))
+	default:
+		return reflect.Value{}, fmt.Errorf("cannot convert protobuf int to type: %v", t)
+	}
+
+	return v, nil
+}
+
+// decodeDouble returns a value of type t from a protobuf double.
+// Integer types only accept whole numbers that fit into them.
+func decodeDouble(f float64, t reflect.Type) (reflect.Value, error) {
+	v := reflect.New(t).Elem()
+
+	switch t.Kind() {
+	case reflect.Float32, reflect.Float64:
+		if v.OverflowFloat(f) {
+			return reflect.Value{}, fmt.Errorf("%v overflows %v", f, t)
+		}
+		v.SetFloat(f)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if f != math.Trunc(f) || f < math.MinInt64 || f >= math.MaxInt64 || v.OverflowInt(int64(f)) {
+			return reflect.Value{}, fmt.Errorf("%v cannot be represented by %v", f, t)
+		}
+		v.SetInt(int64(f))
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		if f != math.Trunc(f) || f < 0 || f >= math.MaxUint64 || v.OverflowUint(uint64(f)) {
+			return reflect.Value{}, fmt.Errorf("%v cannot be represented by %v", f, t)
+		}
+		v.SetUint(uint64(f))
+	case reflect.String:
+		v.SetString(strconv.FormatFloat(f, 'g', -1, 64))
+	case reflect.Interface:
+		if !reflect.TypeOf(f).Implements(t) {
+			return reflect.Value{}, fmt.Errorf("float64 does not implement %v", t)
+		}
+		v.Set(reflect.ValueOf(f))
+	default:
+		return reflect.Value{}, fmt.Errorf("cannot convert protobuf double to type: %v", t)
+	}
+
+	return v, nil
+}
+
+// encodeNumber returns a protobuf Int or Double from a value of a predeclared numeric type.
+// It returns false for other values, named types like enums with a MarshalJSON or MarshalText method
+// and time.Duration are encoded as JSON like before.
+func encodeNumber(v reflect.Value) (*rpc.TypedData, bool, error) {
+	if v.Type().PkgPath() != "" {
+		return nil, false, nil
+	}
+
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return &rpc.TypedData{
+			Data: &rpc.TypedData_Int{
+				Int: v.Int(),
+			},
+		}, true, nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		u := v.Uint()
+		if u > math.MaxInt64 {
+			return nil, true, fmt.Errorf("%d overflows protobuf int", u)
+		}
+		return &rpc.TypedData{
+			Data: &rpc.TypedData_Int{
+				Int: int64(u),
+			},
+		}, true, nil
+	case reflect.Float32, reflect.Float64:
+		return &rpc.TypedData{
+			Data: &rpc.TypedData_Double{
+				Double: v.Float(),
+			},
+		}, true, nil
+	default:
+		return nil, false, nil
+	}
+}
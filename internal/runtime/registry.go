@@ -1,6 +1,7 @@
 package runtime
 
 import (
+	"bytes"
 	"context"
 	"fmt"
 	"go/ast"
@@ -8,48 +9,109 @@ import (
 	"go/token"
 	"plugin"
 	"reflect"
+	"sync"
+	"sync/atomic"
 
-	"github.com/vladbarosan/func-go/internal/rpc"
 	logrus "github.com/Sirupsen/logrus"
+	"github.com/golang/protobuf/proto"
+	"github.com/vladbarosan/func-go/azfunc"
+	"github.com/vladbarosan/func-go/internal/rpc"
 )
 
-// Registry contains all information about user functions and how to execute them
+// Registry contains all information about user functions and how to execute them.
+// It is safe for concurrent use: invocations read the functions without locking
+// while loads replace the whole set of functions under a lock.
 type Registry struct {
-	funcs map[string]*function
+	mu         sync.Mutex
+	funcs      atomic.Value // map[string]*function, never modified after being stored
+	host       atomic.Value // *HostInfo
+	middleware atomic.Value // []azfunc.Middleware, never modified after being stored
+}
+
+// Sender sends messages to the Azure Functions Host
+type Sender interface {
+	Send(*rpc.StreamingMessage) error
 }
 
 // NewRegistry returns a new function registry
 func NewRegistry() *Registry {
-	return &Registry{
-		funcs: map[string]*function{},
+	r := &Registry{}
+	r.funcs.Store(map[string]*function{})
+	r.host.Store(&HostInfo{})
+	r.middleware.Store([]azfunc.Middleware{})
+	return r
+}
+
+// SetHostInfo stores what the host sent in the worker init request so invocations can adapt to it
+func (r *Registry) SetHostInfo(h *HostInfo) {
+	r.host.Store(h)
+}
+
+// HostInfo returns the information the host sent in the worker init request
+func (r *Registry) HostInfo() *HostInfo {
+	return r.host.Load().(*HostInfo)
+}
+
+// getFunc returns the loaded function with the given ID
+func (r *Registry) getFunc(functionID string) (*function, bool) {
+	f, ok := r.funcs.Load().(map[string]*function)[functionID]
+	return f, ok
+}
+
+// setFunc stores the function under the given ID by publishing a copy of the functions that includes it
+func (r *Registry) setFunc(functionID string, f *function) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	old := r.funcs.Load().(map[string]*function)
+	funcs := make(map[string]*function, len(old)+1)
+	for id, v := range old {
+		funcs[id] = v
 	}
+	funcs[functionID] = f
+	r.funcs.Store(funcs)
 }
 
-// LoadFunc populates information about the func from the compiled plugin and from parsing the source code
-func (r Registry) LoadFunc(req *rpc.FunctionLoadRequest) error {
+// Len returns the number of loaded functions
+func (r *Registry) Len() int {
+	return len(r.funcs.Load().(map[string]*function))
+}
+
+// LoadFunc populates information about the func from the compiled plugin and, unless the plugin
+// declares its bindings with an azfunc.Function, from parsing the source code
+func (r *Registry) LoadFunc(req *rpc.FunctionLoadRequest) error {
 	logrus.Debugf("received function load request: %v", req)
 
-	f, err := loadFuncFromPlugin(req.Metadata)
-	if err != nil {
-		return fmt.Errorf("cannot load function from plugin: %v", err)
+	// the host sends the load requests again after the worker reconnects,
+	// functions that are already loaded from the same metadata are kept as they are
+	if f, ok := r.getFunc(req.FunctionId); ok && proto.Equal(f.metadata, req.Metadata) {
+		logrus.Debugf("function %s is already loaded", req.FunctionId)
+		return nil
 	}
 
-	ins, outs, err := loadInOut(req.Metadata, f.signature)
+	f, err := loadFuncFromPlugin(req.Metadata, pluginPath(req.Metadata))
 	if err != nil {
-		return fmt.Errorf("cannot parse entrypoint: %v", err)
+		return err
 	}
 
-	f.in = ins
-	f.out = outs
+	if f.fromSource() {
+		ins, outs, err := loadInOut(req.Metadata, f.signature)
+		if err != nil {
+			return err
+		}
+		f.in = ins
+		f.out = outs
+	}
 
 	logrus.Debugf("function: %v", f)
-	r.funcs[req.FunctionId] = f
+	r.setFunc(req.FunctionId, f)
 
 	return nil
 }
 
-// ExecuteFunc takes an InvocationRequest and executes the function with corresponding function ID
-func (r Registry) ExecuteFunc(req *rpc.InvocationRequest, eventStream rpc.FunctionRpc_EventStreamClient) (response *rpc.InvocationResponse) {
+// ExecuteFunc takes an InvocationRequest and executes the function with corresponding function ID.
+// The azfunc.Context passed to the function is derived from ctx, so cancelling ctx cancels the invocation.
+func (r *Registry) ExecuteFunc(ctx context.Context, req *rpc.InvocationRequest, sender Sender) (response *rpc.InvocationResponse) {
 
 	logrus.Debugf("\n\n\nInvocation Request: %v", req)
 
@@ -61,7 +123,7 @@ func (r Registry) ExecuteFunc(req *rpc.InvocationRequest, eventStream rpc.Functi
 			Status: status,
 		},
 	}
-	f, ok := r.funcs[req.FunctionId]
+	f, ok := r.getFunc(req.FunctionId)
 
 	if !ok {
 		logrus.Debugf("function with functionID %v not loaded", req.FunctionId)
@@ -69,50 +131,159 @@ func (r Registry) ExecuteFunc(req *rpc.InvocationRequest, eventStream rpc.Functi
 		return ir
 	}
 
-	args, err := FromProto(req, f.in)
+	fctx := &funcContext{
+		Context:      ctx,
+		functionID:   req.FunctionId,
+		invocationID: req.InvocationId,
+		category:     fmt.Sprintf("Function.%s.User", f.metadata.GetName()),
+		host:         r.HostInfo(),
+		sender:       sender,
+	}
+	ctxv := reflect.ValueOf(fctx).Elem()
+
+	// the inputs are decoded under the same recover as the function, they can run binding unmarshalers
+	var args map[string]reflect.Value
+	err := protect("input conversion", func() (err error) {
+		args, err = FromProto(req, f.in)
+		return err
+	})
+	if pe, ok := err.(*panicError); ok {
+		return panicked(ir, pe, fctx)
+	}
 	if err != nil {
 		ir.Result.Status = rpc.StatusResult_Failure
 		return ir
 	}
 
-	params := make([]reflect.Value, len(f.in))
-	for _, v := range f.in {
-		isIntf := v.Type.Kind() == reflect.Interface
-		logrus.Debugf("Kind is %v  and is intf:%t and type is %v", v.Type.Kind(), isIntf, v.Type)
-		ctx := &funcContext{
-			Context:      context.Background(),
-			functionID:   req.FunctionId,
-			invocationID: req.InvocationId,
-			eventStream:  eventStream,
+	inputs := map[string]interface{}{}
+	for name, v := range args {
+		inputs[name] = v.Interface()
+	}
+	inv := &azfunc.Invocation{
+		Context: ctxv.Interface().(azfunc.Context),
+		Inputs:  inputs,
+	}
+
+	var output []reflect.Value
+	writers := map[string]*bytes.Buffer{}
+	handler, intercepted := r.chain(f, func(inv *azfunc.Invocation) error {
+		if err := setInputs(args, f.in, inv.Inputs); err != nil {
+			return err
 		}
-		ctxv := reflect.ValueOf(ctx).Elem()
 
-		if v.Type.Kind() == reflect.Interface && ctxv.Type().Implements(v.Type) {
-			logrus.Debug("created context")
-			params[v.Position] = ctxv
-		} else {
-			params[v.Position] = args[v.Name]
+		params := newParams(f.handler.Type())
+		for _, v := range f.in {
+			isIntf := v.Type.Kind() == reflect.Interface
+			logrus.Debugf("Kind is %v  and is intf:%t and type is %v", v.Type.Kind(), isIntf, v.Type)
+
+			if isContextType(v.Type) {
+				logrus.Debug("created context")
+				c := reflect.ValueOf(inv.Context)
+				if !c.IsValid() || !c.Type().AssignableTo(v.Type) {
+					return fmt.Errorf("middleware set context to %T, the function takes %v", inv.Context, v.Type)
+				}
+				setParam(params, v, c)
+			} else if isWriterParam(v) {
+				// output bindings written by the function are sent once it returns
+				w := &bytes.Buffer{}
+				writers[v.Name] = w
+				setParam(params, v, reflect.ValueOf(w))
+			} else {
+				setParam(params, v, args[v.Name])
+			}
 		}
+
+		output = f.Invoke(params)
+		inv.Outputs = invocationOutputs(output, f.handler.Type(), f.out)
+		_, err := funcError(output)
+		return err
+	})
+
+	ferr := invoke(handler, inv)
+	if pe, ok := ferr.(*panicError); ok {
+		return panicked(ir, pe, fctx)
 	}
 
-	output, err := f.Invoke(params)
-	if err != nil {
-		ir.Result.Status = rpc.StatusResult_Failure
-		return ir
+	// middleware can replace the outputs, even of invocations the function did not complete
+	if output == nil {
+		output = zeroResults(f.handler.Type())
+	}
+	if intercepted {
+		if err := setOutputs(output, f.handler.Type(), f.out, inv.Outputs); err != nil {
+			ir.Result.Status = rpc.StatusResult_Failure
+			ir.Result.Exception = &rpc.RpcException{
+				Message: err.Error(),
+				Source:  "User function",
+			}
+			return ir
+		}
+	}
+	// the outputs are encoded under the same recover as the function, they can run binding marshalers and readers
+	var o []*rpc.ParameterBinding
+	var rv *rpc.TypedData
+	var s *rpc.StatusResult
+	err = protect("output conversion", func() (err error) {
+		o, rv, s, err = ToProto(output, f.out, fctx.host.Capabilities)
+		return err
+	})
+	if pe, ok := err.(*panicError); ok {
+		return panicked(ir, pe, fctx)
 	}
-	o, rv, s, err := ToProto(output, f.out)
 
 	if err != nil {
 		logrus.Debugf("cannot get output data from result %v", err)
 		if err != nil {
 			ir.Result.Status = rpc.StatusResult_Failure
+			ir.Result.Exception = &rpc.RpcException{
+				Message: fmt.Sprintf("cannot encode outputs: %v", err),
+				Source:  "User function",
+			}
 			return ir
 		}
 	}
 
+	// the error left by the middleware decides the status, without middleware it is the error of the function
+	if ferr != nil {
+		s.Status = rpc.StatusResult_Failure
+		s.Exception = &rpc.RpcException{
+			Message: ferr.Error(),
+			Source:  "User function",
+		}
+	} else {
+		s.Status = rpc.StatusResult_Success
+		s.Exception = nil
+	}
+
+	for name, w := range writers {
+		o = append(o, &rpc.ParameterBinding{
+			Name: name,
+			Data: &rpc.TypedData{
+				Data: &rpc.TypedData_Bytes{
+					Bytes: w.Bytes(),
+				},
+			},
+		})
+	}
+
 	ir.ReturnValue = rv
 	ir.OutputData = o
 	ir.Result = s
+
+	if fe, ok := ferr.(*azfunc.Error); ok {
+		reportError(ir, fe, f.metadata, fctx)
+	}
+	return ir
+}
+
+// panicked reports a panic in user code as the failure of the invocation, with the stack of the panicking goroutine
+func panicked(ir *rpc.InvocationResponse, pe *panicError, fctx *funcContext) *rpc.InvocationResponse {
+	ir.Result.Status = rpc.StatusResult_Failure
+	ir.Result.Exception = &rpc.RpcException{
+		Message:    pe.Error(),
+		Source:     "User function",
+		StackTrace: string(pe.stack),
+	}
+	fctx.logException(ir.Result.Exception, rpc.RpcLog_Error, "")
 	return ir
 }
 
@@ -121,7 +292,9 @@ type funcContext struct {
 	context.Context
 	functionID   string
 	invocationID string
-	eventStream  rpc.FunctionRpc_EventStreamClient
+	category     string
+	host         *HostInfo
+	sender       Sender
 }
 
 func (c funcContext) FunctionID() string {
@@ -141,47 +314,106 @@ func (c funcContext) Log(level int, format string, args ...interface{}) error {
 		rpcLevel = rpc.RpcLog_Critical
 	}
 
+	// do not send logs the host is configured to discard
+	if min, ok := c.host.logLevel(c.category); ok && rpcLevel < min {
+		return nil
+	}
+
 	l := &rpc.RpcLog{
 		InvocationId: c.invocationID,
+		Category:     c.category,
 		Level:        rpcLevel,
 		Message:      fmt.Sprintf(format, args...),
 	}
 
-	return c.eventStream.Send(&rpc.StreamingMessage{
+	return c.sender.Send(&rpc.StreamingMessage{
 		Content: &rpc.StreamingMessage_RpcLog{
 			RpcLog: l,
 		},
 	})
 }
 
-// loadFuncFromPlugin takes the compiled plugin from the func's bin directory
+// pluginPath returns the path of the compiled plugin in the func's bin directory
+func pluginPath(metadata *rpc.RpcFunctionMetadata) string {
+	return fmt.Sprintf("%s/bin/%s.so", metadata.Directory, metadata.Name)
+}
+
+// logException sends a log with the exception and its JSON serialized properties to the host
+func (c funcContext) logException(e *rpc.RpcException, level rpc.RpcLog_Level, properties string) {
+	err := c.sender.Send(&rpc.StreamingMessage{
+		Content: &rpc.StreamingMessage_RpcLog{
+			RpcLog: &rpc.RpcLog{
+				InvocationId: c.invocationID,
+				Category:     c.category,
+				Level:        level,
+				Message:      e.Message,
+				Exception:    e,
+				Properties:   properties,
+			},
+		},
+	})
+	if err != nil {
+		logrus.Debugf("cannot send exception log: %v", err)
+	}
+}
+
+// loadFuncFromPlugin takes the compiled plugin from path
 // then reads through reflection the in and out paramns of the entrypoint
-func loadFuncFromPlugin(metadata *rpc.RpcFunctionMetadata) (*function, error) {
+func loadFuncFromPlugin(metadata *rpc.RpcFunctionMetadata, path string) (*function, error) {
 
-	path := fmt.Sprintf("%s/bin/%s.so", metadata.Directory, metadata.Name)
 	plugin, err := plugin.Open(path)
 	if err != nil {
-		return nil, fmt.Errorf("cannot get .so object from path %s: %v", path, err)
+		return nil, loadErrorf(PluginOpenError, "cannot get .so object from path %s: %v", path, err)
 	}
 
 	symbol, err := plugin.Lookup(metadata.EntryPoint)
 	if err != nil {
-		return nil, fmt.Errorf("cannot look up symbol for entrypoint function %s: %v", metadata.EntryPoint, err)
+		return nil, loadErrorf(EntryPointNotFound, "cannot look up symbol for entrypoint function %s: %v", metadata.EntryPoint, err)
+	}
+
+	f, err := funcFromSymbol(metadata, symbol)
+	if err != nil {
+		return nil, err
+	}
+	if f.middleware, err = pluginMiddleware(plugin); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// funcFromSymbol returns the function of the entrypoint symbol of a plugin
+func funcFromSymbol(metadata *rpc.RpcFunctionMetadata, symbol interface{}) (*function, error) {
+	if h, ok := httpHandler(symbol); ok {
+		return handlerFunc(metadata, h)
+	}
+	if d, ok := functionDescriptor(symbol); ok {
+		return describedFunc(metadata, d)
 	}
 
 	t := reflect.TypeOf(symbol)
 	if t.Kind() != reflect.Func {
-		return nil, fmt.Errorf("symbol is not func, but %v", t.Kind())
+		return nil, loadErrorf(EntryPointNotFound, "symbol %s is not func, but %v", metadata.EntryPoint, t.Kind())
 	}
 
 	return &function{
 		handler:   reflect.ValueOf(symbol),
 		signature: t,
+		metadata:  metadata,
 	}, nil
 }
 
 type iterator func(int) reflect.Type
 
+var (
+	contextType = reflect.TypeOf(funcContext{})
+	errorType   = reflect.TypeOf((*error)(nil)).Elem()
+)
+
+// isContextType returns true if a parameter of type t receives the azfunc.Context of the invocation
+func isContextType(t reflect.Type) bool {
+	return t.Kind() == reflect.Interface && contextType.Implements(t)
+}
+
 // loadInOut loads the input and output types for a function
 func loadInOut(metadata *rpc.RpcFunctionMetadata, funcType reflect.Type) (map[string]*funcField, map[string]*funcField, error) {
 
@@ -189,23 +421,27 @@ func loadInOut(metadata *rpc.RpcFunctionMetadata, funcType reflect.Type) (map[st
 	fs := token.NewFileSet()
 	f, err := parser.ParseFile(fs, metadata.ScriptFile, nil, parser.AllErrors)
 	if err != nil {
-		return nil, nil, fmt.Errorf("cannot parse file %v: %v", metadata.ScriptFile, err)
+		return nil, nil, loadErrorf(SourceParseError, "cannot parse file %v: %v", metadata.ScriptFile, err)
 	}
 
 	// traverse the AST and inspect the nodes
 	// if the node is a func declaration, check if entrypoint and get input params names and types (as string)
+	found := false
 	ast.Inspect(f, func(n ast.Node) bool {
 		switch x := n.(type) {
 		case *ast.FuncDecl:
 			logrus.Debugf("found function: %v", x.Name.Name)
-			if x.Name.Name != metadata.EntryPoint {
+			if x.Recv != nil || x.Name.Name != metadata.EntryPoint {
 				logrus.Debugf("not function entrypoint, moving on...")
 
 				// not the entrypoint, go further into the AST
 				return true
 			}
 
-			ins, err = extractFuncFields(x.Type.Params, metadata.GetBindings(), funcType.In, funcType.NumIn())
+			found = true
+			if ins, err = extractFuncFields(x.Type.Params, metadata.GetBindings(), funcType.In, funcType.NumIn()); err != nil {
+				return false
+			}
 			outs, err = extractFuncFields(x.Type.Results, metadata.GetBindings(), funcType.Out, funcType.NumOut())
 
 			// this is the entrypoint, no need to traverse the AST any longer
@@ -217,6 +453,18 @@ func loadInOut(metadata *rpc.RpcFunctionMetadata, funcType reflect.Type) (map[st
 		}
 	})
 
+	if !found {
+		return nil, nil, loadErrorf(EntryPointNotFound, "cannot find func %s in file %s", metadata.EntryPoint, metadata.ScriptFile)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	ins = structFields(ins, metadata.GetBindings(), funcType.In, funcType.NumIn())
+	outs = structFields(outs, metadata.GetBindings(), funcType.Out, funcType.NumOut())
+	if err := checkBindings(metadata, funcType, ins, outs); err != nil {
+		return nil, nil, err
+	}
+
 	return ins, outs, nil
 }
 
@@ -224,16 +472,22 @@ func extractFuncFields(fl *ast.FieldList, bindings map[string]*rpc.BindingInfo,
 	fields := map[string]*funcField{}
 
 	if fl.NumFields() != l {
-		return nil, fmt.Errorf("Plugin %d and source %d nr of arguments are different", fl.NumFields(), l)
+		return nil, loadErrorf(SourceParseError, "plugin %d and source %d nr of arguments are different", l, fl.NumFields())
 	}
 
 	if l == 0 {
 		return fields, nil
 	}
 
-	for i, p := range fl.List {
-		t := fi(i)
+	i := 0
+	for _, p := range fl.List {
+		// unnamed fields still take a position
+		if len(p.Names) == 0 {
+			i++
+			continue
+		}
 		for _, n := range p.Names {
+			t := fi(i)
 			logrus.Debugf("Found parameter: %s with type: %s", n, t.String())
 
 			fields[n.Name] = &funcField{
@@ -242,6 +496,7 @@ func extractFuncFields(fl *ast.FieldList, bindings map[string]*rpc.BindingInfo,
 				Position: i,
 				Binding:  bindings[n.Name],
 			}
+			i++
 		}
 	}
 
@@ -6,8 +6,15 @@ package runtime
 
 import (
 	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
 	"net/http"
+	"os"
 	"reflect"
+	"strings"
+	"sync"
 	"testing"
 
 	"github.com/vladbarosan/func-go/azfunc"
@@ -23,7 +30,7 @@ func TestLoadFunc_HttpTriggerBlobBindings(t *testing.T) {
 	if err != nil {
 		t.Fatalf("failed to get a function, got error: %v", err)
 	}
-	f := r.funcs[lr.FunctionId]
+	f, _ := r.getFunc(lr.FunctionId)
 	if got, want := f.signature, reflect.TypeOf(func(azfunc.Context, *http.Request, *string) string { return "" }); got != want {
 		t.Logf("got:  %q\nwant: %q", got, want)
 		t.Fail()
@@ -42,6 +49,203 @@ func TestLoadFunc_HttpTriggerBlobBindings(t *testing.T) {
 	}
 }
 
+func TestLoadFunc_Errors(t *testing.T) {
+	testCases := []struct {
+		name     string
+		modify   func(*rpc.RpcFunctionMetadata)
+		wantKind LoadErrorKind
+		wantMsg  string
+	}{
+		{
+			name:     "missing plugin",
+			modify:   func(m *rpc.RpcFunctionMetadata) { m.Name = "Missing" },
+			wantKind: PluginOpenError,
+			wantMsg:  "bin/Missing.so",
+		},
+		{
+			name:     "missing symbol",
+			modify:   func(m *rpc.RpcFunctionMetadata) { m.EntryPoint = "Missing" },
+			wantKind: EntryPointNotFound,
+			wantMsg:  "Missing",
+		},
+		{
+			name:     "missing source",
+			modify:   func(m *rpc.RpcFunctionMetadata) { m.ScriptFile = "testdata/missing.go" },
+			wantKind: SourceParseError,
+			wantMsg:  "testdata/missing.go",
+		},
+		{
+			name: "missing bindings",
+			modify: func(m *rpc.RpcFunctionMetadata) {
+				delete(m.Bindings, "inBlob")
+				delete(m.Bindings, "outBlob")
+			},
+			wantKind: BindingMismatch,
+			wantMsg:  "inBlob, outBlob",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			lr := loadFunctionLoadRequest(t, "httpTriggerBlobBindings_FunctionLoadRequest.json")
+			tc.modify(lr.Metadata)
+
+			err := NewRegistry().LoadFunc(lr)
+			le, ok := err.(*LoadError)
+			if !ok {
+				t.Fatalf("expected a *LoadError, got: %v", err)
+			}
+			if got, want := le.Kind, tc.wantKind; got != want {
+				t.Logf("got:  %v\nwant: %v", got, want)
+				t.Fail()
+			}
+			if got, want := le.Error(), tc.wantMsg; !strings.Contains(got, want) {
+				t.Logf("got:  %q\nwant to contain: %q", got, want)
+				t.Fail()
+			}
+		})
+	}
+}
+
+func TestRegistry_ConcurrentLoadAndExecute(t *testing.T) {
+	lr := loadFunctionLoadRequest(t, "httpTriggerBlobBindings_FunctionLoadRequest.json")
+	req := loadInvocationRequest(t, "httpTrigger_InvocationRequest.json")
+	blob := loadInvocationRequest(t, "blobInput_InvocationRequest.json")
+
+	const n = 32
+	r := NewRegistry()
+	var wg sync.WaitGroup
+
+	// loads race with invocations of functions that may or may not be loaded yet
+	for i := 0; i < n; i++ {
+		id := fmt.Sprintf("function-%d", i)
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			if err := r.LoadFunc(&rpc.FunctionLoadRequest{FunctionId: id, Metadata: lr.Metadata}); err != nil {
+				t.Errorf("failed to load function %s: %v", id, err)
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			r.ExecuteFunc(context.Background(), newBlobBindingsInvocation(id, req, blob), discardSender{})
+		}()
+	}
+	wg.Wait()
+
+	// every function is loaded now, so all parallel invocations have to succeed
+	for i := 0; i < n; i++ {
+		id := fmt.Sprintf("function-%d", i)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			resp := r.ExecuteFunc(context.Background(), newBlobBindingsInvocation(id, req, blob), discardSender{})
+			if got, want := resp.Result.Status, rpc.StatusResult_Success; got != want {
+				t.Errorf("function %s got status: %v, want: %v", id, got, want)
+				return
+			}
+			if got, want := resp.OutputData[0].Data.GetJson(), `"sample input blob content"`; got != want {
+				t.Errorf("function %s got output: %q, want: %q", id, got, want)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestReloadFile(t *testing.T) {
+	lr := loadFunctionLoadRequest(t, "httpTriggerBlobBindings_FunctionLoadRequest.json")
+
+	r := NewRegistry()
+	if err := r.LoadFunc(lr); err != nil {
+		t.Fatalf("failed to load function, got error: %v", err)
+	}
+
+	reloaded, err := r.ReloadFile("testdata/HttpTriggerBlobBindings/main.go")
+	if err != nil {
+		t.Fatalf("failed to reload source, got error: %v", err)
+	}
+	if got, want := reloaded, []string{lr.FunctionId}; !reflect.DeepEqual(got, want) {
+		t.Logf("got:  %v\nwant: %v", got, want)
+		t.Fail()
+	}
+
+	if reloaded, err := r.ReloadFile("testdata/unrelated.txt"); err != nil || len(reloaded) != 0 {
+		t.Errorf("expected no reloads for an unrelated file, got: %v, %v", reloaded, err)
+	}
+
+	// the unchanged plugin is already loaded from another path, so it cannot be swapped in place
+	if _, err := r.ReloadFile("testdata/HttpTriggerBlobBindings/bin/HttpTriggerBlobBindings.so"); err == nil {
+		t.Errorf("expected an error reloading an already loaded plugin")
+	}
+	if f, _ := r.getFunc(lr.FunctionId); f.in["req"] == nil {
+		t.Errorf("expected the loaded function to be kept after a failed reload")
+	}
+}
+
+func TestLoadPluginCopy(t *testing.T) {
+	const src = "testdata/HttpTriggerBlobBindings/bin/HttpTriggerBlobBindings.so"
+	want, err := ioutil.ReadFile(src)
+	if err != nil {
+		t.Fatalf("cannot read plugin: %v", err)
+	}
+
+	testCases := []struct {
+		name    string
+		loadErr error
+	}{
+		{"loaded", nil},
+		{"failed to load", errors.New("plugin already loaded")},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "reload")
+			if err != nil {
+				t.Fatalf("cannot create temp dir: %v", err)
+			}
+			defer os.RemoveAll(dir)
+			defer os.Setenv("TMPDIR", os.Getenv("TMPDIR"))
+			os.Setenv("TMPDIR", dir)
+
+			_, err = loadPluginCopy(src, "HttpTriggerBlobBindings", func(path string) (*function, error) {
+				if got, err := ioutil.ReadFile(path); err != nil || !bytes.Equal(got, want) {
+					t.Errorf("expected a copy of the plugin at %s, got error: %v", path, err)
+				}
+				return &function{}, tc.loadErr
+			})
+			if err != tc.loadErr {
+				t.Logf("got:  %v\nwant: %v", err, tc.loadErr)
+				t.Fail()
+			}
+
+			files, err := ioutil.ReadDir(dir)
+			if err != nil {
+				t.Fatalf("cannot read temp dir: %v", err)
+			}
+			if len(files) != 0 {
+				t.Errorf("expected the plugin copy to be removed, got: %s", files[0].Name())
+			}
+		})
+	}
+}
+
+// newBlobBindingsInvocation returns an invocation request for the HttpTriggerBlobBindings function with the given ID
+func newBlobBindingsInvocation(functionID string, req, blob *rpc.InvocationRequest) *rpc.InvocationRequest {
+	return &rpc.InvocationRequest{
+		InvocationId:    functionID + "-invocation",
+		FunctionId:      functionID,
+		InputData:       []*rpc.ParameterBinding{req.InputData[0], blob.InputData[0]},
+		TriggerMetadata: req.TriggerMetadata,
+	}
+}
+
+// discardSender drops every message sent by a function
+type discardSender struct{}
+
+func (discardSender) Send(*rpc.StreamingMessage) error {
+	return nil
+}
+
 func loadFunctionLoadRequest(t *testing.T, name string) *rpc.FunctionLoadRequest {
 	b := loadTestData(t, name)
 	r := bytes.NewReader(b)
@@ -0,0 +1,122 @@
+package runtime
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	logrus "github.com/Sirupsen/logrus"
+)
+
+// ReloadFile applies a change of the file at path to the functions built from it and returns the IDs of the reloaded functions.
+// Go plugins cannot be unloaded, so a changed plugin is copied to a fresh path, loaded next to the old one and swapped in.
+// An error means the change cannot be applied in place and the worker has to be restarted to pick it up.
+func (r *Registry) ReloadFile(path string) ([]string, error) {
+	changed := absPath(path)
+	var reloaded []string
+
+	for id, f := range r.funcs.Load().(map[string]*function) {
+		switch changed {
+		case absPath(pluginPath(f.metadata)):
+			nf, err := reloadPlugin(f)
+			if err != nil {
+				return reloaded, fmt.Errorf("cannot reload function %s from %s: %v", f.metadata.Name, path, err)
+			}
+			r.setFunc(id, nf)
+
+		case absPath(f.metadata.ScriptFile):
+			if !f.fromSource() {
+				continue
+			}
+			// the plugin is unchanged, only refresh the parameter names as long as the source still matches it
+			ins, outs, err := loadInOut(f.metadata, f.signature)
+			if err != nil {
+				logrus.Debugf("source of function %s does not match its plugin, waiting for the plugin to be rebuilt: %v", f.metadata.Name, err)
+				continue
+			}
+			nf := *f
+			nf.in = ins
+			nf.out = outs
+			r.setFunc(id, &nf)
+
+		default:
+			continue
+		}
+
+		logrus.Debugf("reloaded function %s after %s changed", f.metadata.Name, path)
+		reloaded = append(reloaded, id)
+	}
+
+	return reloaded, nil
+}
+
+// reloadPlugin loads a function from a versioned copy of its changed plugin
+func reloadPlugin(f *function) (*function, error) {
+	if _, err := os.Stat(pluginPath(f.metadata)); err != nil {
+		return nil, fmt.Errorf("plugin is not available: %v", err)
+	}
+
+	nf, err := loadPluginCopy(pluginPath(f.metadata), f.metadata.Name, func(path string) (*function, error) {
+		return loadFuncFromPlugin(f.metadata, path)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if !nf.fromSource() {
+		return nf, nil
+	}
+	ins, outs, err := loadInOut(f.metadata, nf.signature)
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse entrypoint: %v", err)
+	}
+	nf.in = ins
+	nf.out = outs
+	return nf, nil
+}
+
+// loadPluginCopy loads a function with load from a copy of the plugin at src.
+// The copy is removed once load returns, a loaded plugin stays mapped in memory without its file.
+func loadPluginCopy(src, name string, load func(path string) (*function, error)) (*function, error) {
+	path, err := copyPlugin(src, name)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err := os.Remove(path); err != nil {
+			logrus.Debugf("cannot remove plugin copy %s: %v", path, err)
+		}
+	}()
+
+	return load(path)
+}
+
+// copyPlugin copies the plugin at src to a new file in the temp directory, since a path can only be loaded once
+func copyPlugin(src, name string) (string, error) {
+	in, err := os.Open(src)
+	if err != nil {
+		return "", err
+	}
+	defer in.Close()
+
+	out, err := ioutil.TempFile("", name+"-")
+	if err != nil {
+		return "", err
+	}
+	defer out.Close()
+
+	if _, err := io.Copy(out, in); err != nil {
+		return "", fmt.Errorf("cannot copy plugin %s: %v", src, err)
+	}
+	return out.Name(), nil
+}
+
+// absPath returns the cleaned absolute form of path so paths from the host and from metadata can be compared
+func absPath(path string) string {
+	if abs, err := filepath.Abs(path); err == nil {
+		return abs
+	}
+	return filepath.Clean(path)
+}
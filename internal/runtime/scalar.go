@@ -0,0 +1,176 @@
+package runtime
+
+import (
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/vladbarosan/func-go/internal/hosttime"
+)
+
+var (
+	timeType            = reflect.TypeOf(time.Time{})
+	durationType        = reflect.TypeOf(time.Duration(0))
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+)
+
+// timeSpan matches the [-][d.]hh:mm[:ss[.fffffff]] format of .NET TimeSpan
+var timeSpan = regexp.MustCompile(`^(-)?(?:(\d+)\.)?(\d{1,2}):(\d{1,2})(?::(\d{1,2})(?:\.(\d{1,7}))?)?$`)
+
+// decodeString returns a value of type t parsed from the string s
+func decodeString(s string, t reflect.Type) (reflect.Value, error) {
+	v := reflect.New(t).Elem()
+
+	// time types are checked first, the host uses more date formats than time.Time.UnmarshalText accepts
+	switch t {
+	case timeType:
+		tm, err := hosttime.Parse(s)
+		if err != nil {
+			return reflect.Value{}, err
+		}
+		v.Set(reflect.ValueOf(tm))
+		return v, nil
+	case durationType:
+		d, err := parseDuration(s)
+		if err != nil {
+			return reflect.Value{}, err
+		}
+		v.SetInt(int64(d))
+		return v, nil
+	}
+
+	if reflect.PtrTo(t).Implements(textUnmarshalerType) {
+		if err := v.Addr().Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(s)); err != nil {
+			return reflect.Value{}, err
+		}
+		return v, nil
+	}
+
+	trimmed := strings.TrimSpace(s)
+	switch t.Kind() {
+	case reflect.String:
+		v.SetString(s)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(trimmed)
+		if err != nil {
+			return reflect.Value{}, err
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i, err := strconv.ParseInt(trimmed, 10, t.Bits())
+		if err != nil {
+			return reflect.Value{}, err
+		}
+		v.SetInt(i)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		u, err := strconv.ParseUint(trimmed, 10, t.Bits())
+		if err != nil {
+			return reflect.Value{}, err
+		}
+		v.SetUint(u)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(trimmed, t.Bits())
+		if err != nil {
+			return reflect.Value{}, err
+		}
+		v.SetFloat(f)
+	case reflect.Slice:
+		if t.Elem().Kind() != reflect.Uint8 {
+			return reflect.Value{}, fmt.Errorf("Cannot convert protobuf string to type: %v", t)
+		}
+		v.SetBytes([]byte(s))
+	case reflect.Interface:
+		if !reflect.TypeOf(s).Implements(t) {
+			return reflect.Value{}, fmt.Errorf("Cannot convert protobuf string to type: %v", t)
+		}
+		v.Set(reflect.ValueOf(s))
+	default:
+		return reflect.Value{}, fmt.Errorf("Cannot convert protobuf string to type: %v", t)
+	}
+
+	return v, nil
+}
+
+// isScalar returns true if values of type t are represented by a single string
+func isScalar(t reflect.Type) bool {
+	if t == timeType || t == durationType || reflect.PtrTo(t).Implements(textUnmarshalerType) {
+		return true
+	}
+
+	switch t.Kind() {
+	case reflect.Bool, reflect.String,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr,
+		reflect.Float32, reflect.Float64:
+		return true
+	default:
+		return false
+	}
+}
+
+// jsonString returns the content of a JSON document that is a single string
+func jsonString(data string) (string, bool) {
+	data = strings.TrimSpace(data)
+	if !strings.HasPrefix(data, `"`) {
+		return "", false
+	}
+
+	var s string
+	if err := json.Unmarshal([]byte(data), &s); err != nil {
+		return "", false
+	}
+	return s, true
+}
+
+// parseDuration parses Go durations like 1h30m and .NET TimeSpans like 01:30:00
+func parseDuration(s string) (time.Duration, error) {
+	s = strings.TrimSpace(s)
+	if d, err := time.ParseDuration(s); err == nil {
+		return d, nil
+	}
+
+	m := timeSpan.FindStringSubmatch(s)
+	if m == nil {
+		return 0, fmt.Errorf("cannot parse %q as a duration", s)
+	}
+
+	var d time.Duration
+	units := []struct {
+		value string
+		unit  time.Duration
+	}{
+		{m[2], 24 * time.Hour},
+		{m[3], time.Hour},
+		{m[4], time.Minute},
+		{m[5], time.Second},
+	}
+	for _, u := range units {
+		if u.value == "" {
+			continue
+		}
+		n, err := strconv.ParseInt(u.value, 10, 64)
+		if err != nil {
+			return 0, err
+		}
+		d += time.Duration(n) * u.unit
+	}
+
+	// TimeSpan fractions have up to 7 digits of 100ns ticks
+	if m[6] != "" {
+		ticks, err := strconv.ParseInt(m[6]+strings.Repeat("0", 7-len(m[6])), 10, 64)
+		if err != nil {
+			return 0, err
+		}
+		d += time.Duration(ticks) * 100 * time.Nanosecond
+	}
+
+	if m[1] == "-" {
+		d = -d
+	}
+	return d, nil
+}
@@ -0,0 +1,91 @@
+package runtime
+
+import (
+	"net"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/vladbarosan/func-go/internal/rpc"
+)
+
+func TestDecodeProto_Strings(t *testing.T) {
+	stringData := func(s string) *rpc.TypedData { return &rpc.TypedData{Data: &rpc.TypedData_String_{String_: s}} }
+	jsonData := func(s string) *rpc.TypedData { return &rpc.TypedData{Data: &rpc.TypedData_Json{Json: s}} }
+	date := time.Date(2018, 7, 18, 8, 15, 8, 0, time.UTC)
+	b := true
+
+	testCases := []struct {
+		name    string
+		data    *rpc.TypedData
+		typ     reflect.Type
+		want    interface{}
+		wantErr bool
+	}{
+		{"string to string", stringData(" text "), reflect.TypeOf(""), " text ", false},
+		{"string to bool", stringData("True"), reflect.TypeOf(false), true, false},
+		{"string to bool pointer", stringData("true"), reflect.TypeOf(&b), &b, false},
+		{"invalid bool", stringData("yes"), reflect.TypeOf(false), nil, true},
+		{"string to int", stringData("-42"), reflect.TypeOf(int(0)), int(-42), false},
+		{"string to int8", stringData("127"), reflect.TypeOf(int8(0)), int8(127), false},
+		{"string overflows int8", stringData("128"), reflect.TypeOf(int8(0)), nil, true},
+		{"string to int64", stringData("9223372036854775807"), reflect.TypeOf(int64(0)), int64(9223372036854775807), false},
+		{"string to uint16", stringData("65535"), reflect.TypeOf(uint16(0)), uint16(65535), false},
+		{"negative string to uint", stringData("-1"), reflect.TypeOf(uint(0)), nil, true},
+		{"string to uint64", stringData("18446744073709551615"), reflect.TypeOf(uint64(0)), uint64(18446744073709551615), false},
+		{"string to float32", stringData("1.5"), reflect.TypeOf(float32(0)), float32(1.5), false},
+		{"string to float64", stringData("-2.25e3"), reflect.TypeOf(float64(0)), float64(-2250), false},
+		{"invalid float", stringData("one"), reflect.TypeOf(float64(0)), nil, true},
+		{"string to bytes", stringData("raw"), reflect.TypeOf([]byte(nil)), []byte("raw"), false},
+		{"string to interface", stringData("text"), reflect.TypeOf((*interface{})(nil)).Elem(), "text", false},
+		{"string to map", stringData("text"), reflect.TypeOf(map[string]string{}), nil, true},
+		{"RFC3339 date", stringData("2018-07-18T08:15:08+00:00"), reflect.TypeOf(time.Time{}), date, false},
+		{"RFC3339 date with fraction", stringData("2018-07-18T08:15:08.5Z"), reflect.TypeOf(time.Time{}), date.Add(500 * time.Millisecond), false},
+		{"ISO date without zone", stringData("2018-07-18T08:15:08.0000000"), reflect.TypeOf(time.Time{}), date, false},
+		{".NET JSON date", stringData("/Date(1531901708000)/"), reflect.TypeOf(time.Time{}), date, false},
+		{".NET JSON date with offset", stringData("/Date(1531901708000+0200)/"), reflect.TypeOf(time.Time{}), date, false},
+		{".NET date", stringData("7/18/2018 8:15:08 AM"), reflect.TypeOf(time.Time{}), date, false},
+		{".NET date with offset", stringData("7/18/2018 10:15:08 AM +02:00"), reflect.TypeOf(time.Time{}), date, false},
+		{"RFC1123 date", stringData("Wed, 18 Jul 2018 08:15:08 GMT"), reflect.TypeOf(time.Time{}), date, false},
+		{"invalid date", stringData("yesterday"), reflect.TypeOf(time.Time{}), nil, true},
+		{"JSON date", jsonData(`"2018-07-18T08:15:08Z"`), reflect.TypeOf(time.Time{}), date, false},
+		{"JSON .NET JSON date", jsonData(`"\/Date(1531901708000)\/"`), reflect.TypeOf(time.Time{}), date, false},
+		{"Go duration", stringData("1h30m"), reflect.TypeOf(time.Duration(0)), 90 * time.Minute, false},
+		{".NET TimeSpan", stringData("01:30:00"), reflect.TypeOf(time.Duration(0)), 90 * time.Minute, false},
+		{".NET TimeSpan with days and ticks", stringData("1.02:03:04.5"), reflect.TypeOf(time.Duration(0)), 26*time.Hour + 3*time.Minute + 4500*time.Millisecond, false},
+		{"negative .NET TimeSpan", stringData("-00:00:01"), reflect.TypeOf(time.Duration(0)), -time.Second, false},
+		{"JSON TimeSpan", jsonData(`"00:05:00"`), reflect.TypeOf(time.Duration(0)), 5 * time.Minute, false},
+		{"invalid duration", stringData("soon"), reflect.TypeOf(time.Duration(0)), nil, true},
+		{"TextUnmarshaler", stringData("10.0.0.1"), reflect.TypeOf(net.IP{}), net.ParseIP("10.0.0.1"), false},
+		{"invalid TextUnmarshaler", stringData("10.0.0"), reflect.TypeOf(net.IP{}), nil, true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			v, err := decodeProto(tc.data, tc.typ)
+			if tc.wantErr {
+				if err == nil {
+					t.Fatalf("expected an error, got value: %v", v)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("failed to decode, got error: %v", err)
+			}
+			if got := v.Type(); got != tc.typ {
+				t.Fatalf("got:  %v\nwant: %v", got, tc.typ)
+			}
+			if want, ok := tc.want.(time.Time); ok {
+				if got := v.Interface().(time.Time); !got.Equal(want) {
+					t.Logf("got:  %v\nwant: %v", got, want)
+					t.Fail()
+				}
+				return
+			}
+			if got, want := v.Interface(), tc.want; !reflect.DeepEqual(got, want) {
+				t.Logf("got:  %v\nwant: %v", got, want)
+				t.Fail()
+			}
+		})
+	}
+}
@@ -0,0 +1,85 @@
+package runtime
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"reflect"
+
+	"github.com/vladbarosan/func-go/internal/rpc"
+)
+
+var (
+	bytesType      = reflect.TypeOf([]byte(nil))
+	readerType     = reflect.TypeOf((*io.Reader)(nil)).Elem()
+	readCloserType = reflect.TypeOf((*io.ReadCloser)(nil)).Elem()
+	writerType     = reflect.TypeOf((*io.Writer)(nil)).Elem()
+)
+
+// isReaderType returns true if parameters of type t receive their data as a stream
+func isReaderType(t reflect.Type) bool {
+	return t == readerType || t == readCloserType
+}
+
+// isWriterParam returns true if f is an output binding the function writes its data to
+func isWriterParam(f *funcField) bool {
+	return f.Type == writerType && f.Binding != nil && f.Binding.Direction == rpc.BindingInfo_out
+}
+
+// dataBytes returns the content of string, JSON, bytes and stream data, byte for byte
+func dataBytes(d *rpc.TypedData) ([]byte, bool) {
+	switch d := d.GetData().(type) {
+	case *rpc.TypedData_String_:
+		return []byte(d.String_), true
+	case *rpc.TypedData_Json:
+		return []byte(d.Json), true
+	case *rpc.TypedData_Bytes:
+		return d.Bytes, true
+	case *rpc.TypedData_Stream:
+		return d.Stream, true
+	default:
+		return nil, false
+	}
+}
+
+// decodeBytes returns b as a value of t, which is []byte or a reader type
+func decodeBytes(b []byte, t reflect.Type) reflect.Value {
+	switch t {
+	case readerType:
+		return reflect.ValueOf(bytes.NewReader(b)).Convert(t)
+	case readCloserType:
+		return reflect.ValueOf(ioutil.NopCloser(bytes.NewReader(b))).Convert(t)
+	default:
+		return reflect.ValueOf(b).Convert(t)
+	}
+}
+
+// encodeStream returns protobuf bytes from a byte slice or from the content of a reader, which is closed if it is an io.Closer.
+// It returns false if v is neither.
+func encodeStream(v reflect.Value) (*rpc.TypedData, bool, error) {
+	if v.Type() == bytesType {
+		return &rpc.TypedData{
+			Data: &rpc.TypedData_Bytes{
+				Bytes: v.Bytes(),
+			},
+		}, true, nil
+	}
+
+	r, ok := v.Interface().(io.Reader)
+	if !ok {
+		return nil, false, nil
+	}
+	if c, ok := r.(io.Closer); ok {
+		defer c.Close()
+	}
+
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, true, err
+	}
+	return &rpc.TypedData{
+		Data: &rpc.TypedData_Bytes{
+			Bytes: b,
+		},
+	}, true, nil
+}
@@ -0,0 +1,205 @@
+package runtime
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/vladbarosan/func-go/internal/rpc"
+)
+
+func TestDecodeProto_Streams(t *testing.T) {
+	png, err := ioutil.ReadFile(filepath.Join("testdata", "http", "pixel.png"))
+	if err != nil {
+		t.Fatalf("cannot read fixture: %v", err)
+	}
+
+	testCases := []struct {
+		name string
+		data *rpc.TypedData
+		typ  reflect.Type
+		want []byte
+	}{
+		{"bytes to []byte", &rpc.TypedData{Data: &rpc.TypedData_Bytes{Bytes: png}}, bytesType, png},
+		{"stream to []byte", &rpc.TypedData{Data: &rpc.TypedData_Stream{Stream: png}}, bytesType, png},
+		{"JSON to []byte", &rpc.TypedData{Data: &rpc.TypedData_Json{Json: `{"a":1}`}}, bytesType, []byte(`{"a":1}`)},
+		{"string to []byte", &rpc.TypedData{Data: &rpc.TypedData_String_{String_: "text"}}, bytesType, []byte("text")},
+		{"bytes to io.Reader", &rpc.TypedData{Data: &rpc.TypedData_Bytes{Bytes: png}}, readerType, png},
+		{"stream to io.ReadCloser", &rpc.TypedData{Data: &rpc.TypedData_Stream{Stream: png}}, readCloserType, png},
+		{"string to io.Reader", &rpc.TypedData{Data: &rpc.TypedData_String_{String_: "text"}}, readerType, []byte("text")},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			v, err := decodeProto(tc.data, tc.typ)
+			if err != nil {
+				t.Fatalf("failed to decode, got error: %v", err)
+			}
+			if got := v.Type(); got != tc.typ {
+				t.Fatalf("got:  %v\nwant: %v", got, tc.typ)
+			}
+
+			got, ok := v.Interface().([]byte)
+			if r, isReader := v.Interface().(io.Reader); isReader {
+				got, err = ioutil.ReadAll(r)
+				ok = err == nil
+			}
+			if !ok || !bytes.Equal(got, tc.want) {
+				t.Logf("got:  %x\nwant: %x", got, tc.want)
+				t.Fail()
+			}
+		})
+	}
+}
+
+func TestEncodeProto_Streams(t *testing.T) {
+	testCases := []struct {
+		name  string
+		value interface{}
+	}{
+		{"[]byte", []byte{0x00, 0xff}},
+		{"*bytes.Buffer", bytes.NewBuffer([]byte{0x00, 0xff})},
+		{"io.Reader", io.Reader(bytes.NewReader([]byte{0x00, 0xff}))},
+		{"io.ReadCloser", ioutil.NopCloser(strings.NewReader("\x00\xff"))},
+	}
+
+	want := &rpc.TypedData{Data: &rpc.TypedData_Bytes{Bytes: []byte{0x00, 0xff}}}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := encodeProto(reflect.ValueOf(tc.value), nil)
+			if err != nil {
+				t.Fatalf("failed to encode, got error: %v", err)
+			}
+			if !proto.Equal(got, want) {
+				t.Logf("got:  %v\nwant: %v", got, want)
+				t.Fail()
+			}
+		})
+	}
+}
+
+func TestExecuteFunc_BlobStreams(t *testing.T) {
+	png, err := ioutil.ReadFile(filepath.Join("testdata", "http", "pixel.png"))
+	if err != nil {
+		t.Fatalf("cannot read fixture: %v", err)
+	}
+	in := &rpc.BindingInfo{Type: "blobTrigger", Direction: rpc.BindingInfo_in}
+	out := &rpc.BindingInfo{Type: "blob", Direction: rpc.BindingInfo_out}
+
+	testCases := []struct {
+		name    string
+		handler interface{}
+		in      map[string]*funcField
+		out     map[string]*funcField
+	}{
+		{
+			"io.Reader to io.Writer",
+			func(blob io.Reader, copy io.Writer) error {
+				_, err := io.Copy(copy, blob)
+				return err
+			},
+			map[string]*funcField{
+				"blob": {Name: "blob", Type: readerType, Position: 0, Binding: in},
+				"copy": {Name: "copy", Type: writerType, Position: 1, Binding: out},
+			},
+			map[string]*funcField{},
+		},
+		{
+			"[]byte to []byte",
+			func(blob []byte) (copy []byte) {
+				return blob
+			},
+			map[string]*funcField{
+				"blob": {Name: "blob", Type: bytesType, Position: 0, Binding: in},
+			},
+			map[string]*funcField{
+				"copy": {Name: "copy", Type: bytesType, Position: 0, Binding: out},
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			r := NewRegistry()
+			r.setFunc("blob", &function{
+				handler:  reflect.ValueOf(tc.handler),
+				in:       tc.in,
+				out:      tc.out,
+				metadata: &rpc.RpcFunctionMetadata{Name: "Blob"},
+			})
+
+			resp := r.ExecuteFunc(context.Background(), &rpc.InvocationRequest{
+				InvocationId: "1",
+				FunctionId:   "blob",
+				InputData: []*rpc.ParameterBinding{{
+					Name: "blob",
+					Data: &rpc.TypedData{Data: &rpc.TypedData_Bytes{Bytes: png}},
+				}},
+			}, &recordingSender{})
+
+			if got, want := resp.Result.Status, rpc.StatusResult_Success; got != want {
+				t.Fatalf("got:  %v\nwant: %v", got, want)
+			}
+			if len(resp.OutputData) != 1 || resp.OutputData[0].Name != "copy" {
+				t.Fatalf("expected the copy output, got: %v", resp.OutputData)
+			}
+			if got := resp.OutputData[0].Data.GetBytes(); !bytes.Equal(got, png) {
+				t.Logf("got:  %x\nwant: %x", got, png)
+				t.Fail()
+			}
+		})
+	}
+}
+
+// brokenReader fails or panics when the worker reads the output of a function
+type brokenReader struct {
+	panics bool
+}
+
+func (r brokenReader) Read(p []byte) (int, error) {
+	if r.panics {
+		panic("disk unplugged")
+	}
+	return 0, errors.New("disk full")
+}
+
+func TestExecuteFunc_BrokenReader(t *testing.T) {
+	testCases := []struct {
+		name   string
+		reader io.Reader
+		want   string
+	}{
+		{"error", brokenReader{}, "cannot encode outputs: disk full"},
+		{"panic", brokenReader{panics: true}, "output conversion panicked: disk unplugged"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			handler := func() io.Reader { return tc.reader }
+			r := NewRegistry()
+			r.setFunc("reader", &function{
+				handler:   reflect.ValueOf(handler),
+				signature: reflect.TypeOf(handler),
+				in:        map[string]*funcField{},
+				out:       map[string]*funcField{},
+				metadata:  &rpc.RpcFunctionMetadata{Name: "Reader"},
+			})
+
+			resp := r.ExecuteFunc(context.Background(), &rpc.InvocationRequest{InvocationId: "1", FunctionId: "reader"}, &recordingSender{})
+			if got, want := resp.Result.Status, rpc.StatusResult_Failure; got != want {
+				t.Fatalf("got:  %v\nwant: %v", got, want)
+			}
+			if e := resp.Result.Exception; e == nil || e.Message != tc.want {
+				t.Logf("got:  %v\nwant: %q", e, tc.want)
+				t.Fail()
+			}
+		})
+	}
+}
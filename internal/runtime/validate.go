@@ -0,0 +1,181 @@
+package runtime
+
+import (
+	"fmt"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/vladbarosan/func-go/azfunc"
+	"github.com/vladbarosan/func-go/internal/rpc"
+)
+
+var httpRequestType = reflect.TypeOf(http.Request{})
+
+// checkBindings returns a *LoadError listing every mismatch between the bindings of a function
+// and the params and results of its entry point of type t, so they fail the load instead of the invocations
+func checkBindings(metadata *rpc.RpcFunctionMetadata, t reflect.Type, ins, outs map[string]*funcField) error {
+	var problems []string
+
+	var unbound []string
+	for _, f := range ins {
+		if f.Binding == nil && !isContextType(f.Type) {
+			unbound = append(unbound, f.Name)
+		}
+	}
+	for _, f := range outs {
+		if f.Binding == nil && f.Type != errorType {
+			unbound = append(unbound, f.Name)
+		}
+	}
+	if len(unbound) > 0 {
+		sort.Strings(unbound)
+		problems = append(problems, fmt.Sprintf("no binding in function.json for parameters: %s", strings.Join(unbound, ", ")))
+	}
+
+	var missing []string
+	for name := range metadata.GetBindings() {
+		_, in := ins[name]
+		_, out := outs[name]
+		if !in && !out && name != returnBinding {
+			missing = append(missing, name)
+		}
+	}
+	if len(missing) > 0 {
+		sort.Strings(missing)
+		problems = append(problems, fmt.Sprintf("no parameter for bindings in function.json: %s", strings.Join(missing, ", ")))
+	}
+
+	problems = append(problems, checkPositions(metadata, t, ins, outs)...)
+
+	for _, f := range sortedFields(ins) {
+		if f.Binding == nil || isContextType(f.Type) {
+			continue
+		}
+		if f.Binding.Direction == rpc.BindingInfo_out && !isWriterParam(f) {
+			problems = append(problems, fmt.Sprintf("parameter %s of type %v is bound to an output binding, only io.Writer parameters can be", f.Name, f.Type))
+			continue
+		}
+		if isWriterParam(f) {
+			continue
+		}
+		if err := checkDecodable(f.Type, f.Binding); err != nil {
+			problems = append(problems, fmt.Sprintf("parameter %s of type %v cannot receive the %s binding: %v", f.Name, f.Type, f.Binding.Type, err))
+		}
+	}
+	for _, f := range sortedFields(outs) {
+		if f.Binding == nil {
+			continue
+		}
+		if f.Binding.Direction == rpc.BindingInfo_in {
+			problems = append(problems, fmt.Sprintf("result %s of type %v is bound to an input binding", f.Name, f.Type))
+			continue
+		}
+		if err := checkEncodable(f.Type); err != nil {
+			problems = append(problems, fmt.Sprintf("result %s of type %v cannot be sent to the %s binding: %v", f.Name, f.Type, f.Binding.Type, err))
+		}
+	}
+
+	if len(problems) == 0 {
+		return nil
+	}
+	return loadErrorf(BindingMismatch, "%s", strings.Join(problems, "; "))
+}
+
+// checkPositions returns the problems with the params and results of t that have no name to bind them,
+// only a single result can go unnamed to be sent to the $return binding
+func checkPositions(metadata *rpc.RpcFunctionMetadata, t reflect.Type, ins, outs map[string]*funcField) []string {
+	var problems []string
+
+	named := map[int]bool{}
+	for _, f := range ins {
+		named[f.Position] = true
+	}
+	for i := 0; i < t.NumIn(); i++ {
+		if !named[i] {
+			problems = append(problems, fmt.Sprintf("parameter %d of type %v has no name to bind it", i, t.In(i)))
+		}
+	}
+
+	named = map[int]bool{}
+	for _, f := range outs {
+		named[f.Position] = true
+	}
+	var unnamed []int
+	for i := 0; i < t.NumOut(); i++ {
+		if !named[i] && t.Out(i) != errorType {
+			unnamed = append(unnamed, i)
+		}
+	}
+
+	rb, hasReturn := metadata.GetBindings()[returnBinding]
+	switch {
+	case len(unnamed) == 1 && len(outs) == 0 && hasReturn:
+		if err := checkEncodable(t.Out(unnamed[0])); err != nil {
+			problems = append(problems, fmt.Sprintf("result of type %v cannot be sent to the %s binding: %v", t.Out(unnamed[0]), rb.Type, err))
+		}
+		return problems
+	case hasReturn:
+		problems = append(problems, fmt.Sprintf("binding %s needs a single unnamed result", returnBinding))
+	}
+	for _, i := range unnamed {
+		problems = append(problems, fmt.Sprintf("result %d of type %v has no name to bind it", i, t.Out(i)))
+	}
+	return problems
+}
+
+// checkDecodable returns an error if params of type pt cannot be decoded from the data of binding b
+func checkDecodable(pt reflect.Type, b *rpc.BindingInfo) error {
+	t := pt
+	if pt.Kind() == reflect.Ptr {
+		t = pt.Elem()
+	}
+	if hasConverter(pt, t, true) || reflect.PtrTo(t).Implements(bindingUnmarshalerType) {
+		return nil
+	}
+
+	if b.Type == "httpTrigger" {
+		if t != httpRequestType {
+			return fmt.Errorf("requests are received as *http.Request")
+		}
+		return nil
+	}
+	if t.Kind() == reflect.Interface && t.NumMethod() > 0 && !isReaderType(t) {
+		return fmt.Errorf("only io.Reader, io.ReadCloser and interface{} are supported interfaces")
+	}
+	return checkKind(t)
+}
+
+// checkEncodable returns an error if results of type pt cannot be encoded for an output binding
+func checkEncodable(pt reflect.Type) error {
+	t := pt
+	if pt.Kind() == reflect.Ptr {
+		t = pt.Elem()
+	}
+	if hasConverter(pt, t, false) || pt.Implements(bindingMarshalerType) || reflect.PtrTo(t).Implements(bindingMarshalerType) {
+		return nil
+	}
+	return checkKind(t)
+}
+
+// hasConverter returns true if a converter is registered for pt or t that unmarshals or marshals values
+func hasConverter(pt, t reflect.Type, unmarshal bool) bool {
+	for _, ct := range []reflect.Type{pt, t} {
+		c, ok := azfunc.ConverterFor(ct)
+		if ok && ((unmarshal && c.Unmarshal != nil) || (!unmarshal && c.Marshal != nil)) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkKind returns an error for the kinds of types that have no data representation
+func checkKind(t reflect.Type) error {
+	switch t.Kind() {
+	case reflect.Chan, reflect.Func, reflect.UnsafePointer, reflect.Complex64, reflect.Complex128:
+		return fmt.Errorf("%v values cannot be converted", t.Kind())
+	default:
+		return nil
+	}
+}
@@ -0,0 +1,140 @@
+package runtime
+
+import (
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/vladbarosan/func-go/azfunc"
+	"github.com/vladbarosan/func-go/internal/rpc"
+)
+
+func TestCheckBindings(t *testing.T) {
+	bindings := func(b ...string) map[string]*rpc.BindingInfo {
+		m := map[string]*rpc.BindingInfo{}
+		for i := 0; i+2 < len(b); i += 3 {
+			d := rpc.BindingInfo_in
+			if b[i+2] == "out" {
+				d = rpc.BindingInfo_out
+			}
+			m[b[i]] = &rpc.BindingInfo{Type: b[i+1], Direction: d}
+		}
+		return m
+	}
+
+	testCases := []struct {
+		name     string
+		bindings map[string]*rpc.BindingInfo
+		fn       interface{}
+		want     []string
+	}{
+		{
+			"valid",
+			bindings("req", "httpTrigger", "in", "blob", "blob", "out", "$return", "http", "out"),
+			&azfunc.Function{
+				Handler: func(azfunc.Context, *http.Request, io.Writer) (*http.Response, error) { return nil, nil },
+				In:      []string{"", "req", "blob"},
+				Out:     []string{"", ""},
+			},
+			nil,
+		},
+		{
+			"binding without parameter",
+			bindings("req", "httpTrigger", "in", "inBlob", "blob", "in", "outBlob", "blob", "out"),
+			&azfunc.Function{
+				Handler: func(*http.Request) {},
+				In:      []string{"req"},
+			},
+			[]string{"no parameter for bindings in function.json: inBlob, outBlob"},
+		},
+		{
+			"directions",
+			bindings("msg", "queueTrigger", "in", "out", "queue", "out"),
+			&azfunc.Function{
+				Handler: func(string) string { return "" },
+				In:      []string{"out"},
+				Out:     []string{"msg"},
+			},
+			[]string{
+				"parameter out of type string is bound to an output binding, only io.Writer parameters can be",
+				"result msg of type string is bound to an input binding",
+			},
+		},
+		{
+			"unsupported types",
+			bindings("req", "httpTrigger", "in", "ch", "queue", "in", "fn", "queue", "out"),
+			&azfunc.Function{
+				Handler: func(string, chan int) func() { return nil },
+				In:      []string{"req", "ch"},
+				Out:     []string{"fn"},
+			},
+			[]string{
+				"parameter req of type string cannot receive the httpTrigger binding: requests are received as *http.Request",
+				"parameter ch of type chan int cannot receive the queue binding: chan values cannot be converted",
+				"result fn of type func() cannot be sent to the queue binding: func values cannot be converted",
+			},
+		},
+		{
+			"return without unnamed result",
+			bindings("msg", "queueTrigger", "in", "$return", "queue", "out"),
+			&azfunc.Function{
+				Handler: func(string) error { return nil },
+				In:      []string{"msg"},
+				Out:     []string{""},
+			},
+			[]string{"binding $return needs a single unnamed result"},
+		},
+		{
+			"unnamed result without return",
+			bindings("msg", "queueTrigger", "in"),
+			&azfunc.Function{
+				Handler: func(string) string { return "" },
+				In:      []string{"msg"},
+				Out:     []string{""},
+			},
+			[]string{"result 0 of type string has no name to bind it"},
+		},
+		{
+			"http handler",
+			bindings("req", "httpTrigger", "in", "res", "http", "out"),
+			http.NewServeMux(),
+			nil,
+		},
+		{
+			"http handler with other bindings",
+			bindings("req", "httpTrigger", "in", "$return", "http", "out", "blob", "blob", "in", "msg", "queue", "out"),
+			http.NewServeMux(),
+			[]string{"no parameter for bindings in function.json: blob, msg"},
+		},
+		{
+			"http handler without output",
+			bindings("req", "httpTrigger", "in"),
+			http.NewServeMux(),
+			[]string{"http handler Run needs an http output binding in function.json"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := funcFromSymbol(&rpc.RpcFunctionMetadata{EntryPoint: "Run", Bindings: tc.bindings}, tc.fn)
+			if tc.want == nil {
+				if err != nil {
+					t.Fatalf("failed to load function, got error: %v", err)
+				}
+				return
+			}
+
+			le, ok := err.(*LoadError)
+			if !ok || le.Kind != BindingMismatch {
+				t.Fatalf("expected a binding mismatch, got: %v", err)
+			}
+			for _, want := range tc.want {
+				if got := le.Error(); !strings.Contains(got, want) {
+					t.Logf("got:  %q\nwant to contain: %q", got, want)
+					t.Fail()
+				}
+			}
+		})
+	}
+}
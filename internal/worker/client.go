@@ -4,8 +4,14 @@ import (
 	"context"
 	"fmt"
 	"io"
+	"math"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	log "github.com/Sirupsen/logrus"
+	"github.com/vladbarosan/func-go/azfunc"
 	"github.com/vladbarosan/func-go/internal/rpc"
 	"google.golang.org/grpc"
 )
@@ -17,46 +23,126 @@ type ClientConfig struct {
 	WorkerID         string
 	RequestID        string
 	MaxMessageLength int
+	// ShutdownGracePeriod is how long in-flight invocations are given to finish when the worker receives SIGTERM
+	ShutdownGracePeriod time.Duration
+	// HeartbeatInterval is how often the worker sends a heartbeat to the host, 0 disables heartbeats
+	HeartbeatInterval time.Duration
+	// MaxReconnectAttempts is how many times in a row the worker tries to reconnect to the host, -1 retries forever
+	MaxReconnectAttempts int
+	// ReconnectBackoff is the delay before the first reconnect attempt, doubled on every failed attempt
+	ReconnectBackoff time.Duration
+	// MaxReconnectBackoff caps the delay between reconnect attempts
+	MaxReconnectBackoff time.Duration
+	// Middleware wraps the invocations of every function, around the middleware of their plugins.
+	// The golangWorker command sets none, builds of the worker that need some set it in cmd/root.go.
+	Middleware []azfunc.Middleware
 }
 
 // Client that listens for events from the Azure Functions host and executes Golang methods
 type Client struct {
-	Cfg    *ClientConfig
-	conn   *grpc.ClientConn
-	worker *worker
+	Cfg      *ClientConfig
+	conn     *grpc.ClientConn
+	dialOpts []grpc.DialOption
+	worker   *worker
+
+	mu           sync.Mutex
+	out          *outbound
+	done         chan struct{}
+	shutdownOnce sync.Once
 }
 
 // NewClient returns a new instance of Client
 func NewClient(cfg *ClientConfig) *Client {
+	w := newWorker()
+	w.registry.Use(cfg.Middleware...)
 	return &Client{
 		Cfg:    cfg,
-		worker: newWorker(),
+		worker: w,
+		done:   make(chan struct{}),
 	}
 }
 
-// StartEventStream starts listening for messages from the Azure Functions Host
+// StartEventStream starts listening for messages from the Azure Functions Host.
+// If the stream drops, the client re-dials the host with exponential backoff and restarts the stream
+// with the same worker ID, until the host closes the stream, the worker shuts down or the retries run out.
 func (c *Client) StartEventStream(ctx context.Context, opts ...grpc.CallOption) error {
+	attempt := 0
+	for {
+		established, err := c.runEventStream(ctx, opts...)
+		if err == nil || c.isShuttingDown() {
+			return nil
+		}
+
+		// a stream that worked for a while starts a fresh series of retries
+		if established {
+			attempt = 0
+		}
+		attempt++
+		if c.Cfg.MaxReconnectAttempts >= 0 && attempt > c.Cfg.MaxReconnectAttempts {
+			return fmt.Errorf("event stream failed after %d reconnect attempts: %v", attempt-1, err)
+		}
+
+		delay := backoff(attempt, c.Cfg.ReconnectBackoff, c.Cfg.MaxReconnectBackoff)
+		log.Warnf("event stream failed: %v, reconnecting in %v (attempt %d)", err, delay, attempt)
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-c.done:
+			timer.Stop()
+			return nil
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		}
+
+		if err := c.redial(); err != nil {
+			log.Warnf("cannot re-dial host: %v", err)
+		}
+	}
+}
+
+// runEventStream starts a stream with the host and handles its messages until it ends.
+// It returns a nil error when the host closes the stream or the worker shuts down,
+// and reports whether any message was received from the host before the stream failed.
+// A failed send ends the stream too, since the messages that follow it would be lost.
+func (c *Client) runEventStream(ctx context.Context, opts ...grpc.CallOption) (bool, error) {
 	log.Debugf("starting event stream..")
-	eventStream, err := rpc.NewFunctionRpcClient(c.conn).EventStream(ctx)
+	c.mu.Lock()
+	conn := c.conn
+	c.mu.Unlock()
+
+	// the stream is torn down when it ends, so that a failed send does not leave it half open
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	eventStream, err := rpc.NewFunctionRpcClient(conn).EventStream(ctx, opts...)
 	if err != nil {
-		log.Fatalf("cannot get event stream: %v", err)
-		return err
+		return false, fmt.Errorf("cannot get event stream: %v", err)
 	}
 
-	waitc := make(chan struct{})
+	out := newOutbound(eventStream)
+	c.mu.Lock()
+	c.out = out
+	c.mu.Unlock()
+	defer out.Close()
+
+	var received int32
+	recvErr := make(chan error, 1)
 	go func() {
 		for {
 			message, err := eventStream.Recv()
 			if err == io.EOF {
-				close(waitc)
+				recvErr <- nil
 				return
 			}
 			if err != nil {
-				log.Fatalf("error receiving stream: %v", err)
-				continue
+				recvErr <- err
+				return
 			}
 
-			go c.worker.handleStreamingMessage(message, c, eventStream)
+			atomic.StoreInt32(&received, 1)
+			c.worker.dispatch(message, c, out)
 		}
 	}()
 
@@ -69,14 +155,69 @@ func (c *Client) StartEventStream(ctx context.Context, opts ...grpc.CallOption)
 		},
 	}
 
-	if err = eventStream.Send(startStreamingMessage); err != nil {
-		log.Fatalf("failed to send start streaming request: %v", err)
-		return err
+	if err = out.Send(startStreamingMessage); err != nil {
+		return false, fmt.Errorf("failed to send start streaming request: %v", err)
 	}
 	log.Debugf("sent start streaming message to host")
 
-	<-waitc
-	return nil
+	if c.Cfg.HeartbeatInterval > 0 {
+		stop := make(chan struct{})
+		defer close(stop)
+		go sendHeartbeats(out, c.Cfg.HeartbeatInterval, stop)
+	}
+
+	select {
+	case err = <-recvErr:
+		if err != nil {
+			err = fmt.Errorf("error receiving stream: %v", err)
+		}
+	case err = <-out.failed:
+		err = fmt.Errorf("error sending to stream: %v", err)
+	case <-c.done:
+		return true, nil
+	}
+
+	return atomic.LoadInt32(&received) == 1, err
+}
+
+// cancelledInvocationWait is how long Shutdown waits for the invocations it cancelled to respond
+const cancelledInvocationWait = time.Second
+
+// Shutdown stops accepting new invocations, waits up to gracePeriod for in-flight invocations to finish,
+// cancels the remaining ones, waits briefly for their responses and closes the event stream.
+// StartEventStream returns once shutdown completes.
+func (c *Client) Shutdown(gracePeriod time.Duration) {
+	c.shutdownOnce.Do(func() {
+		log.Debugf("shutting down worker with grace period %v", gracePeriod)
+		if !c.worker.invocations.drain(gracePeriod) {
+			log.Debugf("grace period elapsed, remaining invocations were cancelled")
+			// give the cancelled invocations a moment to send their failure before the stream closes
+			if !c.worker.invocations.wait(cancelledInvocationWait) {
+				log.Debugf("cancelled invocations still running, closing the stream without their responses")
+			}
+		}
+
+		c.mu.Lock()
+		out := c.out
+		c.mu.Unlock()
+
+		// flush pending responses and logs before closing the stream
+		if out != nil {
+			out.Close()
+		}
+		close(c.done)
+		log.Debugf("worker shut down")
+	})
+}
+
+// isShuttingDown returns true once Shutdown has completed
+func (c *Client) isShuttingDown() bool {
+	select {
+	case <-c.done:
+		return true
+	default:
+		return false
+	}
 }
 
 // Connect tries to establish a grpc connection with the server
@@ -90,16 +231,42 @@ func (c *Client) Connect(opts ...grpc.DialOption) (err error) {
 		return
 	}
 
+	c.mu.Lock()
 	c.conn = conn
+	c.dialOpts = opts
+	c.mu.Unlock()
 	log.Debugf("started grpc connection...")
 	return
 }
 
 // Disconnect closes the connection to the server
 func (c *Client) Disconnect() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
 	return c.conn.Close()
 }
 
+// redial replaces the connection to the server with a new one using the options of the initial connection
+func (c *Client) redial() error {
+	conn, err := c.getGRPCConnection(c.dialOpts)
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	old := c.conn
+	c.conn = conn
+	c.mu.Unlock()
+
+	if old != nil {
+		if err := old.Close(); err != nil {
+			log.Debugf("failed to close previous grpc connection: %v", err)
+		}
+	}
+	log.Debugf("re-dialed grpc connection...")
+	return nil
+}
+
 //getGRPCConnection returns a new grpc connection
 func (c *Client) getGRPCConnection(opts []grpc.DialOption) (conn *grpc.ClientConn, err error) {
 	host := fmt.Sprintf("%s:%d", c.Cfg.Host, c.Cfg.Port)
@@ -109,3 +276,47 @@ func (c *Client) getGRPCConnection(opts []grpc.DialOption) (conn *grpc.ClientCon
 	}
 	return conn, nil
 }
+
+// sendHeartbeats sends a heartbeat to the host every interval until stop is closed or the stream fails
+func sendHeartbeats(out *outbound, interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+
+		heartbeat := &rpc.StreamingMessage{
+			Content: &rpc.StreamingMessage_WorkerHeartbeat{
+				WorkerHeartbeat: &rpc.WorkerHeartbeat{},
+			},
+		}
+		if err := out.Send(heartbeat); err != nil {
+			log.Debugf("stopping heartbeats: %v", err)
+			return
+		}
+	}
+}
+
+// backoff returns the delay before the given reconnect attempt: the base delay doubled for every
+// previous attempt, capped at max if it is positive, with up to half of it replaced by random jitter.
+// Without max, the delay stops doubling before it overflows.
+func backoff(attempt int, base, max time.Duration) time.Duration {
+	if base <= 0 {
+		return 0
+	}
+
+	d := base
+	for i := 1; i < attempt && (max <= 0 || d < max) && d <= math.MaxInt64/2; i++ {
+		d *= 2
+	}
+	if max > 0 && d > max {
+		d = max
+	}
+
+	half := d / 2
+	return half + time.Duration(rand.Int63n(int64(half)+1))
+}
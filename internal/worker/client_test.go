@@ -0,0 +1,250 @@
+package worker
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/vladbarosan/func-go/internal/rpc"
+	"github.com/vladbarosan/func-go/internal/runtime"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestBackoff(t *testing.T) {
+	testCases := []struct {
+		attempt  int
+		base     time.Duration
+		max      time.Duration
+		wantBase time.Duration
+	}{
+		{1, 100 * time.Millisecond, time.Second, 100 * time.Millisecond},
+		{2, 100 * time.Millisecond, time.Second, 200 * time.Millisecond},
+		{4, 100 * time.Millisecond, time.Second, 800 * time.Millisecond},
+		{5, 100 * time.Millisecond, time.Second, time.Second},
+		{50, 100 * time.Millisecond, time.Second, time.Second},
+		{3, 0, time.Second, 0},
+		{4, 100 * time.Millisecond, 0, 800 * time.Millisecond},
+		{40, 100 * time.Millisecond, 0, 100 * time.Millisecond << 36},
+		{1000, 100 * time.Millisecond, 0, 100 * time.Millisecond << 36},
+		{2, math.MaxInt64, 0, math.MaxInt64},
+	}
+
+	for _, tc := range testCases {
+		t.Run(fmt.Sprintf("attempt %d", tc.attempt), func(t *testing.T) {
+			for i := 0; i < 100; i++ {
+				got := backoff(tc.attempt, tc.base, tc.max)
+				if got < tc.wantBase/2 || got > tc.wantBase {
+					t.Fatalf("got:  %v\nwant: between %v and %v", got, tc.wantBase/2, tc.wantBase)
+				}
+			}
+		})
+	}
+}
+
+// reconnectHost is a host whose event streams fail in turn, the second one after a status exchange
+type reconnectHost struct {
+	workerIDs chan string
+	streams   int32
+}
+
+func (h *reconnectHost) EventStream(stream rpc.FunctionRpc_EventStreamServer) error {
+	msg, err := stream.Recv()
+	if err != nil {
+		return err
+	}
+	h.workerIDs <- msg.GetStartStream().GetWorkerId()
+
+	switch atomic.AddInt32(&h.streams, 1) {
+	case 1:
+		return status.Error(codes.Unavailable, "host restarting")
+	case 2:
+		// a stream that delivered a message resets the reconnect attempts
+		if err := stream.Send(&rpc.StreamingMessage{
+			RequestId: "status",
+			Content:   &rpc.StreamingMessage_WorkerStatusRequest{WorkerStatusRequest: &rpc.WorkerStatusRequest{}},
+		}); err != nil {
+			return err
+		}
+		if _, err := stream.Recv(); err != nil {
+			return err
+		}
+		return status.Error(codes.Unavailable, "host restarting")
+	default:
+		return nil
+	}
+}
+
+func TestStartEventStream_Reconnect(t *testing.T) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("cannot listen: %v", err)
+	}
+	host := &reconnectHost{workerIDs: make(chan string, 3)}
+	s := grpc.NewServer()
+	rpc.RegisterFunctionRpcServer(s, host)
+	go s.Serve(lis)
+	defer s.Stop()
+
+	c := NewClient(&ClientConfig{
+		Host:                 "127.0.0.1",
+		Port:                 lis.Addr().(*net.TCPAddr).Port,
+		WorkerID:             "worker-1",
+		RequestID:            "req",
+		MaxMessageLength:     1 << 20,
+		MaxReconnectAttempts: 1,
+		ReconnectBackoff:     time.Millisecond,
+	})
+	if err := c.Connect(); err != nil {
+		t.Fatalf("cannot connect: %v", err)
+	}
+	first := c.conn
+
+	// with a single attempt allowed, the third stream is only reached if the second one reset the attempts
+	if err := c.StartEventStream(context.Background()); err != nil {
+		t.Fatalf("expected the host to close the stream, got error: %v", err)
+	}
+	if c.conn == first {
+		t.Error("expected the client to re-dial the host")
+	}
+
+	close(host.workerIDs)
+	var ids []string
+	for id := range host.workerIDs {
+		ids = append(ids, id)
+	}
+	if got, want := fmt.Sprint(ids), "[worker-1 worker-1 worker-1]"; got != want {
+		t.Logf("got:  %s\nwant: %s", got, want)
+		t.Fail()
+	}
+}
+
+// sendFailureHost is a host that invokes a function on the first event stream and waits for the worker to tear it down,
+// then closes the second one
+type sendFailureHost struct {
+	streams  int32
+	tornDown chan error
+}
+
+func (h *sendFailureHost) EventStream(stream rpc.FunctionRpc_EventStreamServer) error {
+	if _, err := stream.Recv(); err != nil {
+		return err
+	}
+	if atomic.AddInt32(&h.streams, 1) > 1 {
+		return nil
+	}
+
+	if err := stream.Send(&rpc.StreamingMessage{
+		RequestId: "invoke",
+		Content:   &rpc.StreamingMessage_InvocationRequest{InvocationRequest: &rpc.InvocationRequest{InvocationId: "1"}},
+	}); err != nil {
+		return err
+	}
+	for {
+		if _, err := stream.Recv(); err != nil {
+			h.tornDown <- err
+			return err
+		}
+	}
+}
+
+// failResponses makes sending invocation responses fail while the stream stays open
+func failResponses(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+	stream, err := streamer(ctx, desc, cc, method, opts...)
+	return &failingResponseStream{stream}, err
+}
+
+type failingResponseStream struct {
+	grpc.ClientStream
+}
+
+func (s *failingResponseStream) SendMsg(m interface{}) error {
+	if m.(*rpc.StreamingMessage).GetInvocationResponse() != nil {
+		return status.Error(codes.ResourceExhausted, "response too large")
+	}
+	return s.ClientStream.SendMsg(m)
+}
+
+func TestStartEventStream_SendFailureReconnects(t *testing.T) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("cannot listen: %v", err)
+	}
+	host := &sendFailureHost{tornDown: make(chan error, 1)}
+	s := grpc.NewServer()
+	rpc.RegisterFunctionRpcServer(s, host)
+	go s.Serve(lis)
+	defer s.Stop()
+
+	c := NewClient(&ClientConfig{
+		Host:                 "127.0.0.1",
+		Port:                 lis.Addr().(*net.TCPAddr).Port,
+		WorkerID:             "worker-1",
+		MaxMessageLength:     1 << 20,
+		MaxReconnectAttempts: 1,
+		ReconnectBackoff:     time.Millisecond,
+	})
+	c.worker.execute = func(ctx context.Context, req *rpc.InvocationRequest, sender runtime.Sender) *rpc.InvocationResponse {
+		return &rpc.InvocationResponse{InvocationId: req.InvocationId, Result: &rpc.StatusResult{Status: rpc.StatusResult_Success}}
+	}
+	if err := c.Connect(grpc.WithStreamInterceptor(failResponses)); err != nil {
+		t.Fatalf("cannot connect: %v", err)
+	}
+
+	errc := make(chan error, 1)
+	go func() { errc <- c.StartEventStream(context.Background()) }()
+
+	select {
+	case err := <-errc:
+		if err != nil {
+			t.Fatalf("expected the host to close the second stream, got error: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for the worker to tear down the stream")
+	}
+	select {
+	case <-host.tornDown:
+	default:
+		t.Error("expected the first stream to be torn down")
+	}
+	if got, want := atomic.LoadInt32(&host.streams), int32(2); got != want {
+		t.Logf("got:  %d\nwant: %d", got, want)
+		t.Fail()
+	}
+}
+
+func TestShutdown_CancelledInvocationResponds(t *testing.T) {
+	host := newFakeHostStream()
+	c := NewClient(&ClientConfig{})
+	c.out = newOutbound(host)
+
+	inv, ok := c.worker.invocations.start("1", "req")
+	if !ok {
+		t.Fatal("expected the invocation to start")
+	}
+	// the function only returns once it is cancelled, then reports its failure
+	go func() {
+		<-inv.ctx.Done()
+		time.Sleep(10 * time.Millisecond)
+		inv.respond(func() {
+			sendInvocationResponse(inv.requestID, &rpc.InvocationResponse{
+				InvocationId: inv.id,
+				Result:       &rpc.StatusResult{Status: rpc.StatusResult_Cancelled},
+			}, c.out)
+		})
+		c.worker.invocations.finish(inv)
+	}()
+
+	c.Shutdown(10 * time.Millisecond)
+
+	msg := host.next(t)
+	if got, want := msg.GetInvocationResponse().GetResult().GetStatus(), rpc.StatusResult_Cancelled; got != want {
+		t.Logf("got:  %v\nwant: %v", got, want)
+		t.Fail()
+	}
+}
@@ -0,0 +1,165 @@
+package worker
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/golang/protobuf/ptypes"
+	durpb "github.com/golang/protobuf/ptypes/duration"
+)
+
+// invocation tracks a running function invocation so it can be cancelled by the host
+type invocation struct {
+	id        string
+	requestID string
+	ctx       context.Context
+	cancel    context.CancelFunc
+	done      chan struct{}
+
+	mu        sync.Mutex
+	cancelled bool
+	responded bool
+}
+
+// cancelByHost cancels the context of the invocation and marks it as cancelled by the host
+func (i *invocation) cancelByHost() {
+	i.mu.Lock()
+	i.cancelled = true
+	i.mu.Unlock()
+	i.cancel()
+}
+
+// wasCancelled returns true if the host cancelled the invocation
+func (i *invocation) wasCancelled() bool {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	return i.cancelled
+}
+
+// respond runs send only if no response has been reported for the invocation yet
+func (i *invocation) respond(send func()) {
+	i.mu.Lock()
+	if i.responded {
+		i.mu.Unlock()
+		return
+	}
+	i.responded = true
+	i.mu.Unlock()
+	send()
+}
+
+// invocations keeps track of all in-flight invocations by invocation ID
+type invocations struct {
+	mu       sync.Mutex
+	m        map[string]*invocation
+	wg       sync.WaitGroup
+	draining bool
+}
+
+func newInvocations() *invocations {
+	return &invocations{
+		m: map[string]*invocation{},
+	}
+}
+
+// start registers a new invocation with a cancellable context.
+// It returns false if the worker is draining and no longer accepts invocations.
+func (is *invocations) start(invocationID, requestID string) (*invocation, bool) {
+	is.mu.Lock()
+	defer is.mu.Unlock()
+	if is.draining {
+		return nil, false
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	i := &invocation{
+		id:        invocationID,
+		requestID: requestID,
+		ctx:       ctx,
+		cancel:    cancel,
+		done:      make(chan struct{}),
+	}
+
+	is.m[invocationID] = i
+	is.wg.Add(1)
+	return i, true
+}
+
+// finish removes the invocation and releases its context
+func (is *invocations) finish(i *invocation) {
+	is.mu.Lock()
+	delete(is.m, i.id)
+	is.mu.Unlock()
+
+	i.cancel()
+	close(i.done)
+	is.wg.Done()
+}
+
+// get returns the in-flight invocation with the given ID
+func (is *invocations) get(invocationID string) (*invocation, bool) {
+	is.mu.Lock()
+	defer is.mu.Unlock()
+	i, ok := is.m[invocationID]
+	return i, ok
+}
+
+// len returns the number of in-flight invocations
+func (is *invocations) len() int {
+	is.mu.Lock()
+	defer is.mu.Unlock()
+	return len(is.m)
+}
+
+// drain stops accepting new invocations and waits up to gracePeriod for the in-flight ones to finish.
+// Invocations still running after the grace period are cancelled. It returns true if all of them finished in time.
+func (is *invocations) drain(gracePeriod time.Duration) bool {
+	is.mu.Lock()
+	is.draining = true
+	is.mu.Unlock()
+
+	if is.wait(gracePeriod) {
+		return true
+	}
+
+	is.mu.Lock()
+	defer is.mu.Unlock()
+	for _, i := range is.m {
+		log.Debugf("cancelling invocation %s still in flight after grace period", i.id)
+		i.cancelByHost()
+	}
+	return false
+}
+
+// wait waits up to timeout for the in-flight invocations to finish. It returns true if all of them finished in time.
+func (is *invocations) wait(timeout time.Duration) bool {
+	done := make(chan struct{})
+	go func() {
+		is.wg.Wait()
+		close(done)
+	}()
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case <-done:
+		return true
+	case <-timer.C:
+		return false
+	}
+}
+
+// gracePeriod converts a protobuf duration into a time.Duration, treating missing or invalid values as no grace period
+func gracePeriod(d *durpb.Duration) time.Duration {
+	if d == nil {
+		return 0
+	}
+	gp, err := ptypes.Duration(d)
+	if err != nil || gp < 0 {
+		return 0
+	}
+	return gp
+}
@@ -0,0 +1,106 @@
+package worker
+
+import (
+	"errors"
+	"sync"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/vladbarosan/func-go/internal/rpc"
+)
+
+// outboundQueueLength is the number of messages that can wait to be sent before senders block
+const outboundQueueLength = 128
+
+var errOutboundClosed = errors.New("event stream is closed")
+
+// outbound owns the sending side of the event stream and writes every message from a single goroutine,
+// since a grpc client stream does not support concurrent calls to Send
+type outbound struct {
+	stream rpc.FunctionRpc_EventStreamClient
+	queue  chan *outboundMessage
+	done   chan struct{}
+	// failed receives the first send error, after which the stream has to be torn down
+	failed chan error
+
+	mu     sync.RWMutex
+	closed bool
+
+	// err is the first send error, only accessed by the writer goroutine
+	err error
+}
+
+// outboundMessage is a queued message with the channel its send result is reported on
+type outboundMessage struct {
+	msg  *rpc.StreamingMessage
+	errc chan error
+}
+
+// newOutbound returns an outbound queue for the stream and starts its writer goroutine
+func newOutbound(stream rpc.FunctionRpc_EventStreamClient) *outbound {
+	o := &outbound{
+		stream: stream,
+		queue:  make(chan *outboundMessage, outboundQueueLength),
+		done:   make(chan struct{}),
+		failed: make(chan error, 1),
+	}
+	go o.run()
+	return o
+}
+
+// Send queues msg and blocks until it has been written to the stream.
+// Senders block while the queue is full, and the error of a failed write is returned to the caller.
+func (o *outbound) Send(msg *rpc.StreamingMessage) error {
+	m := &outboundMessage{
+		msg:  msg,
+		errc: make(chan error, 1),
+	}
+
+	o.mu.RLock()
+	if o.closed {
+		o.mu.RUnlock()
+		return errOutboundClosed
+	}
+	o.queue <- m
+	o.mu.RUnlock()
+
+	return <-m.errc
+}
+
+// Close stops accepting messages, waits for the queued ones to be written and closes the sending side of the stream
+func (o *outbound) Close() {
+	o.mu.Lock()
+	if o.closed {
+		o.mu.Unlock()
+		<-o.done
+		return
+	}
+	o.closed = true
+	close(o.queue)
+	o.mu.Unlock()
+
+	<-o.done
+}
+
+// run writes queued messages in order until the queue is closed.
+// Once a write fails every following message fails with the same error, which is also reported on failed.
+func (o *outbound) run() {
+	defer close(o.done)
+
+	for m := range o.queue {
+		if o.err == nil {
+			if err := o.stream.Send(m.msg); err != nil {
+				log.Errorf("failed to send message to host: %v", err)
+				o.err = err
+				o.failed <- err
+			}
+		}
+		m.errc <- o.err
+	}
+
+	if o.err != nil {
+		return
+	}
+	if err := o.stream.CloseSend(); err != nil {
+		log.Debugf("failed to close event stream: %v", err)
+	}
+}
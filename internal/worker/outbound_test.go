@@ -0,0 +1,184 @@
+package worker
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/vladbarosan/func-go/internal/rpc"
+	"google.golang.org/grpc"
+)
+
+// recordingStream is the sending side of an event stream that records its messages,
+// fails from the message failAt on if it is positive and blocks every send on gate if it is set
+type recordingStream struct {
+	grpc.ClientStream
+	failAt int
+	gate   chan struct{}
+
+	sending int32
+	mu      sync.Mutex
+	sent    []*rpc.StreamingMessage
+	closed  bool
+	overlap bool
+}
+
+var errSendFailed = errors.New("connection reset")
+
+func (s *recordingStream) Send(msg *rpc.StreamingMessage) error {
+	if atomic.AddInt32(&s.sending, 1) > 1 {
+		s.mu.Lock()
+		s.overlap = true
+		s.mu.Unlock()
+	}
+	defer atomic.AddInt32(&s.sending, -1)
+
+	if s.gate != nil {
+		<-s.gate
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.failAt > 0 && len(s.sent)+1 >= s.failAt {
+		return errSendFailed
+	}
+	s.sent = append(s.sent, msg)
+	return nil
+}
+
+func (s *recordingStream) Recv() (*rpc.StreamingMessage, error) {
+	select {}
+}
+
+func (s *recordingStream) CloseSend() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closed = true
+	return nil
+}
+
+func message(id string) *rpc.StreamingMessage {
+	return &rpc.StreamingMessage{RequestId: id}
+}
+
+func TestOutbound_ConcurrentSendersKeepTheirOrder(t *testing.T) {
+	const senders, messages = 8, 50
+	stream := &recordingStream{}
+	out := newOutbound(stream)
+
+	var wg sync.WaitGroup
+	for i := 0; i < senders; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < messages; j++ {
+				if err := out.Send(message(fmt.Sprintf("%d-%d", i, j))); err != nil {
+					t.Errorf("failed to send: %v", err)
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+	out.Close()
+
+	if stream.overlap {
+		t.Error("expected the stream to be written by a single goroutine")
+	}
+	if got, want := len(stream.sent), senders*messages; got != want {
+		t.Fatalf("got:  %d\nwant: %d", got, want)
+	}
+	next := make([]int, senders)
+	for _, msg := range stream.sent {
+		var i, j int
+		fmt.Sscanf(msg.RequestId, "%d-%d", &i, &j)
+		if j != next[i] {
+			t.Fatalf("got:  message %d of sender %d\nwant: message %d", j, i, next[i])
+		}
+		next[i]++
+	}
+}
+
+func TestOutbound_SendError(t *testing.T) {
+	stream := &recordingStream{failAt: 2}
+	out := newOutbound(stream)
+	defer out.Close()
+
+	if err := out.Send(message("1")); err != nil {
+		t.Fatalf("expected the first message to be sent, got error: %v", err)
+	}
+	for _, id := range []string{"2", "3", "4"} {
+		if got, want := out.Send(message(id)), errSendFailed; got != want {
+			t.Logf("got:  %v\nwant: %v", got, want)
+			t.Fail()
+		}
+	}
+
+	select {
+	case err := <-out.failed:
+		if err != errSendFailed {
+			t.Logf("got:  %v\nwant: %v", err, errSendFailed)
+			t.Fail()
+		}
+	default:
+		t.Error("expected the send error to be reported")
+	}
+	if got, want := len(stream.sent), 1; got != want {
+		t.Logf("got:  %d\nwant: %d", got, want)
+		t.Fail()
+	}
+}
+
+func TestOutbound_CloseFlushesQueue(t *testing.T) {
+	stream := &recordingStream{gate: make(chan struct{})}
+	out := newOutbound(stream)
+
+	const queued = 5
+	var wg sync.WaitGroup
+	for i := 0; i < queued; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if err := out.Send(message(fmt.Sprint(i))); err != nil {
+				t.Errorf("failed to send: %v", err)
+			}
+		}(i)
+	}
+	// wait for every message to be queued while the stream is blocked on the first one
+	for len(out.queue) < queued-1 {
+		time.Sleep(time.Millisecond)
+	}
+
+	closed := make(chan struct{})
+	go func() {
+		out.Close()
+		close(closed)
+	}()
+	close(stream.gate)
+	<-closed
+	wg.Wait()
+
+	if got, want := len(stream.sent), queued; got != want {
+		t.Logf("got:  %d\nwant: %d", got, want)
+		t.Fail()
+	}
+	if !stream.closed {
+		t.Error("expected the sending side of the stream to be closed")
+	}
+}
+
+func TestOutbound_SendAfterClose(t *testing.T) {
+	stream := &recordingStream{}
+	out := newOutbound(stream)
+	out.Close()
+
+	if got, want := out.Send(message("1")), errOutboundClosed; got != want {
+		t.Logf("got:  %v\nwant: %v", got, want)
+		t.Fail()
+	}
+	if got := len(stream.sent); got != 0 {
+		t.Errorf("expected no message to be sent, got %d", got)
+	}
+}
@@ -1,34 +1,71 @@
 package worker
 
 import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
 	log "github.com/Sirupsen/logrus"
 	"github.com/vladbarosan/func-go/internal/rpc"
 	"github.com/vladbarosan/func-go/internal/runtime"
 )
 
+// Version is the version of the worker reported to the host
+const Version = "0.1.0"
+
 type worker struct {
-	registry *runtime.Registry
+	registry    *runtime.Registry
+	invocations *invocations
+	// execute runs an invocation, it is the ExecuteFunc of the registry outside of tests
+	execute func(ctx context.Context, req *rpc.InvocationRequest, sender runtime.Sender) *rpc.InvocationResponse
 }
 
 // newWorker returns a new instance of Client
 func newWorker() *worker {
+	r := runtime.NewRegistry()
 	return &worker{
-		registry: runtime.NewRegistry(),
+		registry:    r,
+		invocations: newInvocations(),
+		execute:     r.ExecuteFunc,
+	}
+}
+
+// dispatch handles a message received from the host in its own goroutine.
+// Invocations are registered before, so a cancel that follows its request always finds the invocation in flight.
+func (w worker) dispatch(message *rpc.StreamingMessage, client *Client, out *outbound) {
+	if req := message.GetInvocationRequest(); req != nil {
+		if _, ok := w.invocations.start(req.InvocationId, message.RequestId); !ok {
+			log.Debugf("not registering invocation %s, worker is shutting down", req.InvocationId)
+		}
 	}
+	go w.handleStreamingMessage(message, client, out)
 }
 
-func (w worker) handleStreamingMessage(message *rpc.StreamingMessage, client *Client, eventStream rpc.FunctionRpc_EventStreamClient) {
+func (w worker) handleStreamingMessage(message *rpc.StreamingMessage, client *Client, out *outbound) {
 	log.Debugf("received message: %v", message)
 	switch m := message.Content.(type) {
 
 	case *rpc.StreamingMessage_WorkerInitRequest:
-		w.handleWorkerInitRequest(message.RequestId, m, client, eventStream)
+		w.handleWorkerInitRequest(message.RequestId, m, client, out)
 
 	case *rpc.StreamingMessage_FunctionLoadRequest:
-		w.handleFunctionLoadRequest(message.RequestId, m, client, eventStream)
+		w.handleFunctionLoadRequest(message.RequestId, m, client, out)
 
 	case *rpc.StreamingMessage_InvocationRequest:
-		w.handleInvocationRequest(message.RequestId, m, client, eventStream)
+		w.handleInvocationRequest(message.RequestId, m, client, out)
+
+	case *rpc.StreamingMessage_InvocationCancel:
+		w.handleInvocationCancel(message.RequestId, m, client, out)
+
+	case *rpc.StreamingMessage_WorkerTerminate:
+		w.handleWorkerTerminate(message.RequestId, m, client, out)
+
+	case *rpc.StreamingMessage_WorkerStatusRequest:
+		w.handleWorkerStatusRequest(message.RequestId, m, client, out)
+
+	case *rpc.StreamingMessage_FileChangeEventRequest:
+		w.handleFileChangeEventRequest(message.RequestId, m, client, out)
 
 	default:
 		log.Debugf("received message: %v", message)
@@ -38,15 +75,25 @@ func (w worker) handleStreamingMessage(message *rpc.StreamingMessage, client *Cl
 func (w worker) handleWorkerInitRequest(requestID string,
 	message *rpc.StreamingMessage_WorkerInitRequest,
 	client *Client,
-	eventStream rpc.FunctionRpc_EventStreamClient) {
+	out *outbound) {
 
 	log.Debugf("received worker init request with host version %s",
 		message.WorkerInitRequest.HostVersion)
 
+	req := message.WorkerInitRequest
+	w.registry.SetHostInfo(&runtime.HostInfo{
+		Version:       req.HostVersion,
+		Capabilities:  runtime.Capabilities(req.Capabilities),
+		LogCategories: req.LogCategories,
+	})
+	log.Debugf("host capabilities: %v, log categories: %v", req.Capabilities, req.LogCategories)
+
 	workerInitResponse := &rpc.StreamingMessage{
 		RequestId: requestID,
 		Content: &rpc.StreamingMessage_WorkerInitResponse{
 			WorkerInitResponse: &rpc.WorkerInitResponse{
+				WorkerVersion: Version,
+				Capabilities:  runtime.WorkerCapabilities(),
 				Result: &rpc.StatusResult{
 					Status: rpc.StatusResult_Success,
 				},
@@ -54,8 +101,9 @@ func (w worker) handleWorkerInitRequest(requestID string,
 		},
 	}
 
-	if err := eventStream.Send(workerInitResponse); err != nil {
-		log.Fatalf("failed to send worker init response: %v", err)
+	if err := out.Send(workerInitResponse); err != nil {
+		log.Errorf("failed to send worker init response: %v", err)
+		return
 	}
 	log.Debugf("sent start worker init response: %v", workerInitResponse)
 }
@@ -63,13 +111,19 @@ func (w worker) handleWorkerInitRequest(requestID string,
 func (w worker) handleFunctionLoadRequest(requestID string,
 	message *rpc.StreamingMessage_FunctionLoadRequest,
 	client *Client,
-	eventStream rpc.FunctionRpc_EventStreamClient) {
+	out *outbound) {
 
-	status := rpc.StatusResult_Success
-	err := w.registry.LoadFunc(message.FunctionLoadRequest)
-	if err != nil {
-		status = rpc.StatusResult_Failure
-		log.Debugf("could not load function: %v", err)
+	result := &rpc.StatusResult{
+		Status: rpc.StatusResult_Success,
+	}
+	if err := w.registry.LoadFunc(message.FunctionLoadRequest); err != nil {
+		name := message.FunctionLoadRequest.GetMetadata().GetName()
+		log.Errorf("could not load function %s: %v", name, err)
+		result.Status = rpc.StatusResult_Failure
+		result.Exception = &rpc.RpcException{
+			Message: fmt.Sprintf("cannot load function %s: %v", name, err),
+			Source:  "Go worker",
+		}
 	}
 
 	functionLoadResponse := &rpc.StreamingMessage{
@@ -77,15 +131,14 @@ func (w worker) handleFunctionLoadRequest(requestID string,
 		Content: &rpc.StreamingMessage_FunctionLoadResponse{
 			FunctionLoadResponse: &rpc.FunctionLoadResponse{
 				FunctionId: message.FunctionLoadRequest.FunctionId,
-				Result: &rpc.StatusResult{
-					Status: status,
-				},
+				Result:     result,
 			},
 		},
 	}
 
-	if err := eventStream.Send(functionLoadResponse); err != nil {
-		log.Fatalf("failed to send function load response: %v", err)
+	if err := out.Send(functionLoadResponse); err != nil {
+		log.Errorf("failed to send function load response: %v", err)
+		return
 	}
 	log.Debugf("sent function load response: %v", functionLoadResponse)
 }
@@ -93,10 +146,172 @@ func (w worker) handleFunctionLoadRequest(requestID string,
 func (w worker) handleInvocationRequest(requestID string,
 	message *rpc.StreamingMessage_InvocationRequest,
 	client *Client,
-	eventStream rpc.FunctionRpc_EventStreamClient) {
+	out *outbound) {
+
+	// the invocation was registered when it was received, unless the worker is draining
+	req := message.InvocationRequest
+	inv, ok := w.invocations.get(req.InvocationId)
+	if !ok {
+		log.Debugf("rejecting invocation %s, worker is shutting down", req.InvocationId)
+		sendInvocationResponse(requestID, &rpc.InvocationResponse{
+			InvocationId: req.InvocationId,
+			Result: &rpc.StatusResult{
+				Status: rpc.StatusResult_Failure,
+				Exception: &rpc.RpcException{
+					Message: "worker is shutting down",
+					Source:  "Worker",
+				},
+			},
+		}, out)
+		return
+	}
+
+	response := w.execute(inv.ctx, req, out)
+
+	// a function that fails after the host cancelled it is reported as cancelled, not failed
+	if inv.wasCancelled() && response.Result.Status != rpc.StatusResult_Success {
+		response.Result.Status = rpc.StatusResult_Cancelled
+	}
+
+	inv.respond(func() {
+		sendInvocationResponse(requestID, response, out)
+	})
+	w.invocations.finish(inv)
+}
+
+func (w worker) handleInvocationCancel(requestID string,
+	message *rpc.StreamingMessage_InvocationCancel,
+	client *Client,
+	out *outbound) {
+
+	invocationID := message.InvocationCancel.InvocationId
+	inv, ok := w.invocations.get(invocationID)
+	if !ok {
+		log.Debugf("received cancel for invocation %s which is not in flight", invocationID)
+		return
+	}
+
+	gp := gracePeriod(message.InvocationCancel.GracePeriod)
+	log.Debugf("cancelling invocation %s with grace period %v", invocationID, gp)
+	inv.cancelByHost()
+
+	// give the function the grace period to return on its own before reporting it as cancelled
+	timer := time.NewTimer(gp)
+	defer timer.Stop()
+
+	select {
+	case <-inv.done:
+		return
+	case <-timer.C:
+	}
+
+	log.Debugf("invocation %s did not finish within the grace period", invocationID)
+	inv.respond(func() {
+		sendInvocationResponse(inv.requestID, &rpc.InvocationResponse{
+			InvocationId: invocationID,
+			Result: &rpc.StatusResult{
+				Status: rpc.StatusResult_Cancelled,
+				Result: "invocation cancelled by host",
+			},
+		}, out)
+	})
+}
+
+func (w worker) handleWorkerTerminate(requestID string,
+	message *rpc.StreamingMessage_WorkerTerminate,
+	client *Client,
+	out *outbound) {
 
-	response := w.registry.ExecuteFunc(message.InvocationRequest, eventStream)
+	gp := gracePeriod(message.WorkerTerminate.GracePeriod)
+	log.Debugf("received worker terminate request with grace period %v", gp)
+	client.Shutdown(gp)
+}
+
+// workerStatus contains the counters reported to the host with a worker status response
+type workerStatus struct {
+	LoadedFunctions     int `json:"loadedFunctions"`
+	InFlightInvocations int `json:"inFlightInvocations"`
+}
+
+func (w worker) handleWorkerStatusRequest(requestID string,
+	message *rpc.StreamingMessage_WorkerStatusRequest,
+	client *Client,
+	out *outbound) {
+
+	status := workerStatus{
+		LoadedFunctions:     w.registry.Len(),
+		InFlightInvocations: w.invocations.len(),
+	}
+	log.Debugf("received worker status request, status: %+v", status)
+
+	// the status response has no fields, so the counters are reported in a log sent right before it
+	properties, err := json.Marshal(status)
+	if err != nil {
+		log.Errorf("failed to marshal worker status: %v", err)
+		return
+	}
+	statusLog := &rpc.StreamingMessage{
+		RequestId: requestID,
+		Content: &rpc.StreamingMessage_RpcLog{
+			RpcLog: &rpc.RpcLog{
+				Category:   "Worker.Status",
+				Level:      rpc.RpcLog_Debug,
+				Message:    fmt.Sprintf("%d functions loaded, %d invocations in flight", status.LoadedFunctions, status.InFlightInvocations),
+				Properties: string(properties),
+			},
+		},
+	}
+	if err := out.Send(statusLog); err != nil {
+		log.Errorf("failed to send worker status log: %v", err)
+		return
+	}
+
+	workerStatusResponse := &rpc.StreamingMessage{
+		RequestId: requestID,
+		Content: &rpc.StreamingMessage_WorkerStatusResponse{
+			WorkerStatusResponse: &rpc.WorkerStatusResponse{},
+		},
+	}
+	if err := out.Send(workerStatusResponse); err != nil {
+		log.Errorf("failed to send worker status response: %v", err)
+	}
+}
+
+func (w worker) handleFileChangeEventRequest(requestID string,
+	message *rpc.StreamingMessage_FileChangeEventRequest,
+	client *Client,
+	out *outbound) {
+
+	event := message.FileChangeEventRequest
+	log.Debugf("received file change event %v for %s", event.Type, event.FullPath)
+
+	// loaded plugins stay in memory, so a deleted file does not affect running functions
+	if event.Type == rpc.FileChangeEventRequest_Deleted {
+		return
+	}
+
+	reloaded, err := w.registry.ReloadFile(event.FullPath)
+	if err == nil {
+		log.Debugf("reloaded functions %v", reloaded)
+		return
+	}
+
+	log.Debugf("cannot apply file change in place, requesting restart: %v", err)
+	workerActionResponse := &rpc.StreamingMessage{
+		RequestId: requestID,
+		Content: &rpc.StreamingMessage_WorkerActionResponse{
+			WorkerActionResponse: &rpc.WorkerActionResponse{
+				Action: rpc.WorkerActionResponse_Restart,
+				Reason: err.Error(),
+			},
+		},
+	}
+	if err := out.Send(workerActionResponse); err != nil {
+		log.Errorf("failed to send worker action response: %v", err)
+	}
+}
 
+func sendInvocationResponse(requestID string, response *rpc.InvocationResponse, out *outbound) {
 	invocationResponse := &rpc.StreamingMessage{
 		RequestId: requestID,
 		Content: &rpc.StreamingMessage_InvocationResponse{
@@ -104,7 +319,7 @@ func (w worker) handleInvocationRequest(requestID string,
 		},
 	}
 
-	if err := eventStream.Send(invocationResponse); err != nil {
-		log.Fatalf("failed to send function invocation response: %v", err)
+	if err := out.Send(invocationResponse); err != nil {
+		log.Errorf("failed to send function invocation response: %v", err)
 	}
 }
@@ -0,0 +1,258 @@
+package worker
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/ptypes"
+	"github.com/vladbarosan/func-go/internal/rpc"
+	"github.com/vladbarosan/func-go/internal/runtime"
+	"google.golang.org/grpc"
+)
+
+func TestHandleWorkerInitRequest(t *testing.T) {
+	host := newFakeHostStream()
+	out := newOutbound(host)
+	defer out.Close()
+
+	w := newWorker()
+	w.handleStreamingMessage(&rpc.StreamingMessage{
+		RequestId: "init-request",
+		Content: &rpc.StreamingMessage_WorkerInitRequest{
+			WorkerInitRequest: &rpc.WorkerInitRequest{
+				HostVersion:  "2.0.0",
+				Capabilities: map[string]string{runtime.RawHTTPBodyBytes: "true"},
+			},
+		},
+	}, nil, out)
+
+	resp := host.next(t).GetWorkerInitResponse()
+	if resp == nil {
+		t.Fatalf("expected a worker init response")
+	}
+	if got, want := resp.WorkerVersion, Version; got != want {
+		t.Logf("got:  %q\nwant: %q", got, want)
+		t.Fail()
+	}
+	if got, want := runtime.Capabilities(resp.Capabilities).Has(runtime.WorkerStatus), true; got != want {
+		t.Logf("got:  %t\nwant: %t", got, want)
+		t.Fail()
+	}
+	if got, want := w.registry.HostInfo().Capabilities.Has(runtime.RawHTTPBodyBytes), true; got != want {
+		t.Logf("got:  %t\nwant: %t", got, want)
+		t.Fail()
+	}
+}
+
+func TestHandleWorkerStatusRequest(t *testing.T) {
+	host := newFakeHostStream()
+	out := newOutbound(host)
+	defer out.Close()
+
+	w := newWorker()
+	inv, _ := w.invocations.start("invocation", "invocation-request")
+	defer w.invocations.finish(inv)
+
+	w.handleStreamingMessage(&rpc.StreamingMessage{
+		RequestId: "status-request",
+		Content: &rpc.StreamingMessage_WorkerStatusRequest{
+			WorkerStatusRequest: &rpc.WorkerStatusRequest{},
+		},
+	}, nil, out)
+
+	statusLog := host.next(t).GetRpcLog()
+	if statusLog == nil {
+		t.Fatalf("expected a worker status log")
+	}
+	var status workerStatus
+	if err := json.Unmarshal([]byte(statusLog.Properties), &status); err != nil {
+		t.Fatalf("failed to unmarshal status properties: %v", err)
+	}
+	if got, want := status, (workerStatus{LoadedFunctions: 0, InFlightInvocations: 1}); got != want {
+		t.Logf("got:  %+v\nwant: %+v", got, want)
+		t.Fail()
+	}
+
+	msg := host.next(t)
+	if msg.GetWorkerStatusResponse() == nil {
+		t.Fatalf("expected a worker status response, got: %v", msg)
+	}
+	if got, want := msg.RequestId, "status-request"; got != want {
+		t.Logf("got:  %q\nwant: %q", got, want)
+		t.Fail()
+	}
+}
+
+func TestSendHeartbeats(t *testing.T) {
+	host := newFakeHostStream()
+	out := newOutbound(host)
+	defer out.Close()
+
+	stop := make(chan struct{})
+	defer close(stop)
+	go sendHeartbeats(out, 10*time.Millisecond, stop)
+
+	for i := 0; i < 2; i++ {
+		if msg := host.next(t); msg.GetWorkerHeartbeat() == nil {
+			t.Fatalf("expected a heartbeat, got: %v", msg)
+		}
+	}
+}
+
+func invocationRequest(id string) *rpc.StreamingMessage {
+	return &rpc.StreamingMessage{
+		RequestId: "req-" + id,
+		Content: &rpc.StreamingMessage_InvocationRequest{
+			InvocationRequest: &rpc.InvocationRequest{InvocationId: id, FunctionId: "func"},
+		},
+	}
+}
+
+func invocationCancel(id string, gracePeriod time.Duration) *rpc.StreamingMessage {
+	return &rpc.StreamingMessage{
+		Content: &rpc.StreamingMessage_InvocationCancel{
+			InvocationCancel: &rpc.InvocationCancel{InvocationId: id, GracePeriod: ptypes.DurationProto(gracePeriod)},
+		},
+	}
+}
+
+// waitForCancel is a function that fails once its context is done, or succeeds if it is never cancelled
+func waitForCancel(started chan<- struct{}) func(context.Context, *rpc.InvocationRequest, runtime.Sender) *rpc.InvocationResponse {
+	return func(ctx context.Context, req *rpc.InvocationRequest, sender runtime.Sender) *rpc.InvocationResponse {
+		if started != nil {
+			close(started)
+		}
+		status := rpc.StatusResult_Success
+		select {
+		case <-ctx.Done():
+			status = rpc.StatusResult_Failure
+		case <-time.After(time.Second):
+		}
+		return &rpc.InvocationResponse{InvocationId: req.InvocationId, Result: &rpc.StatusResult{Status: status}}
+	}
+}
+
+func TestInvocationCancel(t *testing.T) {
+	testCases := []struct {
+		name string
+		// wait is true if the cancel is only sent once the function runs
+		wait bool
+	}{
+		{"cancel before start", false},
+		{"cancel during run", true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			host := newFakeHostStream()
+			out := newOutbound(host)
+			defer out.Close()
+
+			started := make(chan struct{})
+			w := newWorker()
+			w.execute = waitForCancel(started)
+
+			w.dispatch(invocationRequest("1"), nil, out)
+			if tc.wait {
+				<-started
+			}
+			w.dispatch(invocationCancel("1", time.Second), nil, out)
+
+			resp := host.next(t).GetInvocationResponse()
+			if resp == nil {
+				t.Fatal("expected an invocation response")
+			}
+			if got, want := resp.Result.Status, rpc.StatusResult_Cancelled; got != want {
+				t.Logf("got:  %v\nwant: %v", got, want)
+				t.Fail()
+			}
+		})
+	}
+}
+
+func TestInvocationCancel_GracePeriod(t *testing.T) {
+	host := newFakeHostStream()
+	out := newOutbound(host)
+	defer out.Close()
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	finished := make(chan struct{})
+	w := newWorker()
+	// the function ignores the cancellation until it is released
+	w.execute = func(ctx context.Context, req *rpc.InvocationRequest, sender runtime.Sender) *rpc.InvocationResponse {
+		close(started)
+		<-release
+		return &rpc.InvocationResponse{InvocationId: req.InvocationId, Result: &rpc.StatusResult{Status: rpc.StatusResult_Success}}
+	}
+
+	w.dispatch(invocationRequest("1"), nil, out)
+	<-started
+	w.dispatch(invocationCancel("1", 10*time.Millisecond), nil, out)
+
+	resp := host.next(t).GetInvocationResponse()
+	if resp == nil {
+		t.Fatal("expected an invocation response")
+	}
+	if got, want := resp.Result.Status, rpc.StatusResult_Cancelled; got != want {
+		t.Logf("got:  %v\nwant: %v", got, want)
+		t.Fail()
+	}
+
+	// the function still runs after the grace period, its own response is not sent
+	inv, ok := w.invocations.get("1")
+	if !ok {
+		t.Fatal("expected the invocation to be in flight after the grace period")
+	}
+	go func() {
+		<-inv.done
+		close(finished)
+	}()
+	close(release)
+	<-finished
+
+	select {
+	case msg := <-host.sent:
+		t.Errorf("expected a single response, got: %v", msg)
+	case <-time.After(10 * time.Millisecond):
+	}
+}
+
+// fakeHostStream is the worker side of an event stream whose sent messages are inspected by tests
+type fakeHostStream struct {
+	grpc.ClientStream
+	sent chan *rpc.StreamingMessage
+}
+
+func newFakeHostStream() *fakeHostStream {
+	return &fakeHostStream{
+		sent: make(chan *rpc.StreamingMessage, outboundQueueLength),
+	}
+}
+
+func (s *fakeHostStream) Send(msg *rpc.StreamingMessage) error {
+	s.sent <- msg
+	return nil
+}
+
+func (s *fakeHostStream) Recv() (*rpc.StreamingMessage, error) {
+	return nil, io.EOF
+}
+
+func (s *fakeHostStream) CloseSend() error {
+	return nil
+}
+
+// next returns the next message sent by the worker
+func (s *fakeHostStream) next(t *testing.T) *rpc.StreamingMessage {
+	select {
+	case msg := <-s.sent:
+		return msg
+	case <-time.After(time.Second):
+		t.Fatalf("timed out waiting for a message from the worker")
+		return nil
+	}
+}
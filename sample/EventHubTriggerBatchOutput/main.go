@@ -7,12 +7,12 @@ import (
 )
 
 // Run is the entrypoint to our Go Azure Function - if you want to change it, see function.json
-func Run(ctx azfunc.Context, ehMsg *azfunc.EventHubEvent) (outMsgs []string) {
-	ctx.Log(azfunc.LogInformation, "Log message from function %v, invocation %v to the runtime with batch data: %s and msg %v", ctx.FunctionID(), ctx.InvocationID(), ehMsg)
+func Run(ctx azfunc.Context, ehMsgs []azfunc.EventHubEvent) (outMsgs []string) {
+	ctx.Log(azfunc.LogInformation, "Log message from function %v, invocation %v to the runtime with a batch of %d events", ctx.FunctionID(), ctx.InvocationID(), len(ehMsgs))
 
-	outMsgs = make([]string, 10)
-	for i := 0; i < 10; i++ {
-		outMsgs[i] = fmt.Sprintf("Message %d from Azure Functions for Go", i)
+	outMsgs = make([]string, len(ehMsgs))
+	for i, e := range ehMsgs {
+		outMsgs[i] = fmt.Sprintf("Event %d enqueued at %v from Azure Functions for Go: %v", e.SequenceNumber, e.EnqueuedTimeUtc, e.Data)
 	}
 	return
 }
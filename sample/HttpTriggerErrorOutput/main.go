@@ -20,6 +20,10 @@ func Run(ctx azfunc.Context, req *http.Request) (resp *http.Response, err error)
 
 	// get query param values
 	name := req.URL.Query().Get("name")
+	if name == "" {
+		// azfunc errors are sent as the HTTP response with their status code
+		return nil, azfunc.Errorf(http.StatusBadRequest, "missing required parameter: name")
+	}
 	respBody := fmt.Sprintf("Azure Functions for Go says: Hello world, %s!", name)
 
 	resp = &http.Response{
@@ -34,12 +38,6 @@ func Run(ctx azfunc.Context, req *http.Request) (resp *http.Response, err error)
 		Header:        make(http.Header, 0),
 	}
 
-	if name == "" {
-		resp.StatusCode = 400
-		resp.Status = "400 BAD REQUEST"
-		err = fmt.Errorf("Missing require parameter: name")
-	}
-
 	resp.Header.Add("customHeader", "azfuncHello")
 	return
 }
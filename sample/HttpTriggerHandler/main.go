@@ -0,0 +1,31 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+// Handler serves this Azure Function because it is specified in `function.json` as
+// the entryPoint. Any http.Handler works, so existing routers can be mounted as they are.
+var Handler = newMux()
+
+func newMux() *http.ServeMux {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("/api/handler/hello", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "Azure Functions for Go says: Hello world, %s!", r.URL.Query().Get("name"))
+	})
+
+	mux.HandleFunc("/api/handler/echo", func(w http.ResponseWriter, r *http.Request) {
+		var data map[string]interface{}
+		if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
+			http.Error(w, fmt.Sprintf("failed to unmarshal JSON: %v", err), http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(data)
+	})
+
+	return mux
+}
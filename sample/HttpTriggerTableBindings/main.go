@@ -6,12 +6,23 @@ import (
 	"github.com/vladbarosan/func-go/azfunc"
 )
 
+// Inputs are bound to the input bindings named in the azfunc tags of their fields
+type Inputs struct {
+	Req    *http.Request          `azfunc:"req"`
+	Person map[string]interface{} `azfunc:"in"`
+}
+
+// Outputs are sent to the output bindings named in the azfunc tags of their fields
+type Outputs struct {
+	Person map[string]interface{} `azfunc:"out"`
+}
+
 // Run is the entrypoint to our Go Azure Function - if you want to change it, see function.json
-func Run(ctx azfunc.Context, req *http.Request, in map[string]interface{}) (out map[string]interface{}) {
-	ctx.Log(azfunc.LogInformation, "function id: %s, invocation id: %s with person name: %v", ctx.FunctionID(), ctx.InvocationID(), in["name"])
+func Run(ctx azfunc.Context, in Inputs) (out Outputs) {
+	ctx.Log(azfunc.LogInformation, "function id: %s, invocation id: %s with person name: %v", ctx.FunctionID(), ctx.InvocationID(), in.Person["name"])
 
-	out = map[string]interface{}{}
-	out["name"] = "new name"
-	out["RowKey"] = "newTestKey"
+	out.Person = map[string]interface{}{}
+	out.Person["name"] = "new name"
+	out.Person["RowKey"] = "newTestKey"
 	return
 }